@@ -0,0 +1,285 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// before anything is written, plain maps out where every command of the index and its listicles will end up: the
+// routes of pages, copied directories & files, and of redirects & aliases. collisions between them would otherwise
+// surface as pages silently overwriting one another (or, for rn, as a copied directory being deleted), so they're
+// reported up front, and the build stopped. the redirect maps written into the webroot (see redirect-maps) claim their
+// files too, so that a site's own .htaccess or _redirects isn't mistaken for one
+
+type claim struct {
+	route   string // e.g. /articles/trustnet
+	kind    string // what's written at the route: a page, a directory, a file, a redirect, an alias or a redirect map
+	by      string // the command claiming the route, e.g. "articles: md wiki/trustnet.md"
+	src     string // the directory being copied, or the markdown file rendered as the page
+	renamed bool   // the route was set by rn, which replaces whatever is at the route
+}
+
+type siteMap struct {
+	claims    []claim
+	redirects map[string]claim  // the routes redirected by mv & as -> the claim of the redirect
+	targets   map[string]string // the routes redirected by mv & as -> the link they redirect to
+	problems  []string          // collisions found while mapping out the site
+}
+
+// the page, file, or directory written to the webroot by a listicle entry (or repository), and the redirects to it
+func (m *siteMap) planEntry(listicle, webpath string, underParent bool, el Element) {
+	var rewrittenDest, link string
+	for _, p := range el.pairs {
+		switch symbol(p.code) {
+		case PATH_WWWROOT:
+			rewrittenDest = p.content
+		case LINK:
+			link = p.content
+		}
+	}
+	var entry claim
+	var redirects []claim
+	for _, p := range el.pairs {
+		by := fmt.Sprintf("%s: %s %s", listicle, p.code, p.content)
+		switch symbol(p.code) {
+		case GIT_REPO:
+			// the readme is written under the repository's name, in place of any ww
+			route := filepath.Join("/", filepath.Base(p.content))
+			if underParent {
+				route = filepath.Join("/", webpath, filepath.Base(p.content))
+			}
+			entry = claim{route: route, kind: "page", by: by}
+		case COPY_DIR:
+			base := filepath.Base(p.content)
+			if rewrittenDest != "" {
+				base = rewrittenDest
+			}
+			entry = claim{route: filepath.Join("/", base), kind: "directory", by: by, src: p.content}
+		case VERBATIM:
+			entry = claim{route: filepath.Join("/", filepath.Base(p.content)), kind: "file", by: by}
+		case PATH_MD:
+			_, articleName := extractFilenames(p.content)
+			if rewrittenDest != "" {
+				articleName = rewrittenDest
+			}
+			route := filepath.Join("/", articleName)
+			if underParent {
+				route = filepath.Join("/", webpath, articleName)
+			}
+			entry = claim{route: route, kind: "page", by: by, src: p.content}
+		case RENAME:
+			if entry.route == "" {
+				continue
+			}
+			entry.route = filepath.Join(filepath.Dir(entry.route), p.content)
+			entry.by = fmt.Sprintf("%s (renamed by rn %s)", entry.by, p.content)
+			entry.renamed = true
+		case REDIRECT:
+			redirects = append(redirects, claim{route: p.content, kind: "redirect", by: by})
+		case ALIAS:
+			redirects = append(redirects, claim{route: p.content, kind: "alias", by: by})
+		}
+	}
+	// entries that don't write anything themselves (ln) redirect to their link
+	if entry.route != "" {
+		m.claims = append(m.claims, entry)
+		link = entry.route
+	}
+	for _, r := range redirects {
+		m.redirect(r, link)
+	}
+}
+
+func (m *siteMap) redirect(r claim, target string) {
+	if target == "" {
+		return
+	}
+	r.route = filepath.Join("/", r.route)
+	if previous, exists := m.redirects[r.route]; exists {
+		if m.targets[r.route] != target {
+			m.problems = append(m.problems, fmt.Sprintf("%s is redirected to both %s (by %s) and %s (by %s)", r.route, m.targets[r.route], previous.by, target, r.by))
+		}
+		return
+	}
+	m.claims = append(m.claims, r)
+	m.redirects[r.route] = r
+	m.targets[r.route] = target
+}
+
+// maps out the routes claimed by the index & the listicles it includes
+func planSite(elements []Element) *siteMap {
+	m := &siteMap{redirects: make(map[string]claim), targets: make(map[string]string)}
+	pages := make(map[string]bool) // groups of the index sharing a route are rendered as a single page
+	for _, format := range strings.Fields(configString("redirect-maps", "")) {
+		if rm, exists := redirectMaps[format]; exists && rm.webroot {
+			m.claims = append(m.claims, claim{route: filepath.Join("/", rm.filename), kind: "redirect map", by: "config: redirect-maps " + format})
+		}
+	}
+	for _, el := range elements {
+		var webpath, src string
+		var underParent, producesPage bool
+		var redirects []claim
+		for _, p := range el.pairs {
+			by := fmt.Sprintf("index: %s %s", p.code, p.content)
+			switch symbol(p.code) {
+			case PATH_WWWROOT:
+				webpath = p.content
+			case UNDER_CATEGORY:
+				underParent = true
+			case PATH_MD:
+				producesPage = true
+				src = p.content
+			case TITLE, BRIEF, HEADER_IMAGE:
+				producesPage = true
+			case PATH_SSG:
+				producesPage = true
+				for _, entry := range readListicle(p.content) {
+					m.planEntry(p.content, webpath, underParent, entry)
+				}
+			case COPY_DIR:
+				m.claims = append(m.claims, claim{route: filepath.Join("/", filepath.Base(p.content)), kind: "directory", by: by, src: p.content})
+			case REDIRECT:
+				redirects = append(redirects, claim{route: p.content, kind: "redirect", by: by})
+			}
+		}
+		if webpath != "" && producesPage && !pages[webpath] {
+			pages[webpath] = true
+			m.claims = append(m.claims, claim{route: webpath, kind: "page", by: fmt.Sprintf("index: ww %s", webpath), src: src})
+		}
+		for _, r := range redirects {
+			m.redirect(r, webpath)
+		}
+	}
+	return m
+}
+
+// the file written for a claim, relative to the webroot: pages are written to their route's file (see routeFile), and
+// non-.html redirects as index.html files of their route's directory
+func (c claim) output() string {
+	route := filepath.Join("/", c.route)
+	switch c.kind {
+	case "directory", "file", "redirect map":
+		return route
+	}
+	if strings.HasSuffix(route, ".html") {
+		return route
+	}
+	if c.kind == "page" {
+		return routeFile(route)
+	}
+	return filepath.Join(route, "index.html")
+}
+
+// the problems with the planned site: routes claimed more than once, redirects shadowing pages, rn replacing a copied
+// directory, and redirect loops. redirect chains work, if slowly, so they're returned separately as warnings
+func (m *siteMap) conflicts() ([]string, []string) {
+	problems := m.problems
+	var warnings []string
+	byOutput := make(map[string][]claim)
+	var outputs []string
+	for _, c := range m.claims {
+		out := c.output()
+		if _, exists := byOutput[out]; !exists {
+			outputs = append(outputs, out)
+		}
+		byOutput[out] = append(byOutput[out], c)
+	}
+	for i, c := range m.claims {
+		if c.kind != "directory" {
+			continue
+		}
+		for j, other := range m.claims {
+			if i != j && other.renamed && filepath.Join("/", other.route) == filepath.Join("/", c.route) {
+				problems = append(problems, fmt.Sprintf("%s would replace the directory %s, copied by %s", other.by, c.route, c.by))
+			}
+		}
+		// a page written into a copied directory only collides with it if the directory has an index of its own
+		index := filepath.Join("/", c.route, "index.html")
+		if _, err := os.Stat(filepath.Join(c.src, "index.html")); err == nil && len(byOutput[index]) > 0 {
+			byOutput[index] = append(byOutput[index], claim{route: c.route, kind: "copied index.html", by: c.by})
+		}
+	}
+
+	for _, out := range outputs {
+		claims := byOutput[out]
+		if len(claims) < 2 {
+			continue
+		}
+		first := claims[0]
+		for _, c := range claims[1:] {
+			switch {
+			case c.kind == first.kind && c.by == first.by && c.src == first.src && c.route == first.route:
+				// the same command planned twice, e.g. by a listicle included by two routes, writes the same thing twice
+				continue
+			case c.kind == "page" && first.kind == "page" && c.src != "" && c.src == first.src && c.route == first.route:
+				// the same markdown rendered to the same route, e.g. by the index and a listicle listing it, is the
+				// same page written twice
+				continue
+			case c.kind == "redirect" || c.kind == "alias":
+				problems = append(problems, fmt.Sprintf("%s shadows the %s at %s, declared by %s", c.by, first.kind, c.route, first.by))
+			case first.kind == "redirect" || first.kind == "alias":
+				problems = append(problems, fmt.Sprintf("%s shadows the %s at %s, declared by %s", first.by, c.kind, c.route, c.by))
+			default:
+				problems = append(problems, fmt.Sprintf("%s is claimed by both %s (a %s) and %s (a %s)", c.route, first.by, first.kind, c.by, c.kind))
+			}
+		}
+	}
+
+	var sources []string
+	for source := range m.redirects {
+		sources = append(sources, source)
+	}
+	sort.Strings(sources)
+	looped := make(map[string]bool) // the routes of loops already reported
+	for _, source := range sources {
+		if looped[source] {
+			continue
+		}
+		chain := []string{source}
+		visited := map[string]bool{source: true}
+		next := m.redirectedTo(source)
+		for next != "" {
+			chain = append(chain, next)
+			if visited[next] {
+				problems = append(problems, fmt.Sprintf("%s redirects in a loop: %s", m.redirects[source].by, strings.Join(chain, " -> ")))
+				for _, route := range chain {
+					looped[route] = true
+				}
+				break
+			}
+			visited[next] = true
+			next = m.redirectedTo(next)
+		}
+		if next == "" && len(chain) > 2 {
+			warnings = append(warnings, fmt.Sprintf("%s redirects through a chain: %s; consider redirecting to %s directly", m.redirects[source].by, strings.Join(chain, " -> "), chain[len(chain)-1]))
+		}
+	}
+	return problems, warnings
+}
+
+// the route that route redirects to, if it's redirected
+func (m *siteMap) redirectedTo(route string) string {
+	if i := strings.IndexAny(route, "#?"); i != -1 {
+		route = route[:i]
+	}
+	return m.targets[filepath.Join("/", route)]
+}
+
+// reports the collisions between the routes of the site, returning an error listing them if there are any
+func checkConflicts(elements []Element) error {
+	problems, warnings := planSite(elements).conflicts()
+	for _, warning := range warnings {
+		fmt.Println("plain: warning:", warning)
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	var lines []string
+	for _, problem := range problems {
+		lines = append(lines, "plain: conflict: "+problem)
+	}
+	return fmt.Errorf("%s\nplain: stopped before writing any pages; resolve the conflicts above and try again", strings.Join(lines, "\n"))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var testSymbols = map[string]int{
+	"tt": TITLE, "bb": BRIEF, "md": PATH_MD, "ln": LINK, "ww": PATH_WWWROOT, "cf": PATH_SSG, "cp": COPY_DIR,
+	"mv": REDIRECT, "as": ALIAS, "gt": GIT_REPO, "rn": RENAME, "un": UNDER_CATEGORY, "vb": VERBATIM,
+}
+
+// writes the files of a site into a temporary directory, and runs the test from it
+func inSite(t *testing.T, files map[string]string) {
+	dir := t.TempDir()
+	for name, contents := range files {
+		filename := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(filename), 0777); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filename, []byte(contents), 0666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestConflicts(t *testing.T) {
+	symbols = testSymbols
+	tests := []struct {
+		name     string
+		config   map[string]string
+		files    map[string]string
+		problems []string // substrings of the expected problems, in order; none if empty
+		warnings []string
+	}{
+		{
+			name:  "distinct routes",
+			files: map[string]string{"index": "ww /articles\ncf articles\n", "articles": "md wiki/one.md\n\nmd wiki/two.md\n"},
+		},
+		{
+			name: "same markdown from the index and a listicle",
+			files: map[string]string{
+				"index":    "ww /articles\ncf articles\n\nww /support\nmd wiki/life/support.md\n",
+				"articles": "md wiki/life/support.md\nmv /support.html\n",
+			},
+		},
+		{
+			name: "different markdown claiming a route",
+			files: map[string]string{
+				"index":    "ww /articles\ncf articles\n\nww /support\nmd wiki/support.md\n",
+				"articles": "md wiki/life/support.md\n",
+			},
+			problems: []string{"/support is claimed by both articles: md wiki/life/support.md (a page) and index: ww /support (a page)"},
+		},
+		{
+			name:     "two listicle entries claiming a route",
+			files:    map[string]string{"index": "ww /\ncf articles\n", "articles": "md a/notes.md\n\nmd b/notes.md\n"},
+			problems: []string{"/notes is claimed by both"},
+		},
+		{
+			name:     "redirect shadowing a page",
+			files:    map[string]string{"index": "ww /\ncf articles\n", "articles": "md wiki/first.md\n\nmd wiki/second.md\nmv /first\n"},
+			problems: []string{"articles: mv /first shadows the page at /first"},
+		},
+		{
+			name:     "alias shadowing a page",
+			files:    map[string]string{"index": "ww /\ncf articles\n", "articles": "md wiki/first.md\nas /second\n\nmd wiki/second.md\n"},
+			problems: []string{"articles: as /second shadows the page at /second"},
+		},
+		{
+			name:     "redirect to .html shadowing a page written as .html",
+			config:   map[string]string{"urls": "html"},
+			files:    map[string]string{"index": "ww /\ncf articles\n", "articles": "md wiki/first.md\nmv /first.html\n"},
+			problems: []string{"articles: mv /first.html shadows the page at /first"},
+		},
+		{
+			name:     "route redirected to two places",
+			files:    map[string]string{"index": "ww /\ncf articles\n", "articles": "md wiki/one.md\nmv /old\n\nmd wiki/two.md\nmv /old\n"},
+			problems: []string{"/old is redirected to both /one (by articles: mv /old) and /two (by articles: mv /old)"},
+		},
+		{
+			name:     "rn replacing a copied directory",
+			files:    map[string]string{"index": "ww /\ncf articles\n\ncp static\n", "articles": "md wiki/one.md\nrn static\n"},
+			problems: []string{"articles: md wiki/one.md (renamed by rn static) would replace the directory /static"},
+		},
+		{
+			name: "listicle included by two routes",
+			files: map[string]string{
+				"index":    "ww /\ncf articles\n\nww /articles\ncf articles\n",
+				"articles": "cp static\n\nvb robots.txt\n\nmd wiki/one.md\nmv /old\n",
+			},
+		},
+		{
+			name:  "rn of a copied directory itself",
+			files: map[string]string{"index": "ww /\ncf articles\n", "articles": "cp static\nrn assets\n"},
+		},
+		{
+			name: "page written into a copied directory with an index of its own",
+			files: map[string]string{
+				"index":             "ww /\ncf articles\n\ncp static\n\nww /static\nmd wiki/static.md\n",
+				"articles":          "",
+				"static/index.html": "<p>copied</p>",
+			},
+			problems: []string{"/static is claimed by both"},
+		},
+		{
+			name:     "redirect loop",
+			files:    map[string]string{"index": "ww /\ncf articles\n", "articles": "ln /b\nmv /a\n\nln /a\nmv /b\n"},
+			problems: []string{"redirects in a loop: /a -> /b -> /a"},
+		},
+		{
+			name:     "redirect chain",
+			files:    map[string]string{"index": "ww /\ncf articles\n", "articles": "ln /b\nmv /a\n\nln /c\nmv /b\n"},
+			warnings: []string{"redirects through a chain: /a -> /b -> /c"},
+		},
+		{
+			name:     "redirect map written over a copied file",
+			config:   map[string]string{"redirect-maps": "nginx apache netlify"},
+			files:    map[string]string{"index": "ww /\ncf articles\n", "articles": "vb _redirects\n\nvb .htaccess\n", "_redirects": "", ".htaccess": ""},
+			problems: []string{"/.htaccess is claimed by both config: redirect-maps apache (a redirect map) and articles: vb .htaccess (a file)", "/_redirects is claimed by both config: redirect-maps netlify (a redirect map) and articles: vb _redirects (a file)"},
+		},
+		{
+			name:   "redirect maps beside the site's other files",
+			config: map[string]string{"redirect-maps": "apache netlify"},
+			files:  map[string]string{"index": "ww /\ncf articles\n", "articles": "vb robots.txt\n", "robots.txt": ""},
+		},
+		{
+			name: "repository readme nested under its listicle",
+			files: map[string]string{
+				"index":    "ww /projects\nun true\ncf projects\n",
+				"projects": "gt /src/plain\n\nmd wiki/plain.md\n",
+			},
+			problems: []string{"/projects/plain is claimed by both"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config = test.config
+			defer func() { config = nil }()
+			files := map[string]string{"static/style.css": ""}
+			for name, contents := range test.files {
+				files[name] = contents
+			}
+			inSite(t, files)
+			problems, warnings := planSite(readListicle("index")).conflicts()
+			expectMessages(t, "problems", problems, test.problems)
+			expectMessages(t, "warnings", warnings, test.warnings)
+		})
+	}
+}
+
+func expectMessages(t *testing.T, kind string, got, want []string) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("expected %d %s, got %d: %q", len(want), kind, len(got), got)
+	}
+	for i := range want {
+		if !strings.Contains(got[i], want[i]) {
+			t.Errorf("expected %s %d to contain %q, got %q", kind, i, want[i], got[i])
+		}
+	}
+}
+
+func TestCheckConflictsReturnsError(t *testing.T) {
+	symbols = testSymbols
+	inSite(t, map[string]string{"index": "ww /\ncf articles\n", "articles": "md a/notes.md\n\nmd b/notes.md\n"})
+	err := checkConflicts(readListicle("index"))
+	if err == nil || !strings.Contains(err.Error(), "plain: conflict: /notes is claimed by both") {
+		t.Fatalf("expected an error listing the conflict, got %v", err)
+	}
+	inSite(t, map[string]string{"index": "ww /\ncf articles\n", "articles": "md a/notes.md\n"})
+	if err := checkConflicts(readListicle("index")); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+}
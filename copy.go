@@ -0,0 +1,485 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cblgh/plain/util"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// directories copied with cp skip the files matched by .plainignore files, which use gitignore's patterns: a .plainignore
+// next to the index applies to every copied directory, and one inside a copied directory (or any of its
+// subdirectories) applies to the files below it. later rules win over earlier ones, so a copied directory's own
+// .plainignore can re-include (!pattern) what the defaults or the site's .plainignore skip
+
+const PLAINIGNORE = ".plainignore"
+
+// skipped unless re-included: version control, dependencies, editor backups & os clutter
+const DEFAULT_IGNORE = `.git/
+node_modules/
+.plainignore
+*~
+.*.swp
+.*.swo
+\#*#
+.DS_Store
+`
+
+type ignoreRule struct {
+	base     string   // the directory of the .plainignore declaring the rule, relative to the copied directory
+	segments []string // the pattern, split on /
+	anchored bool     // the pattern contains a /, and only matches relative to base
+	dirOnly  bool     // the pattern ends with /, and only matches directories
+	negated  bool     // the pattern starts with !, and re-includes what it matches
+}
+
+type ignoreRules []ignoreRule
+
+// parses the gitignore-style patterns of a .plainignore, declared in the directory base. source names the file in
+// messages about invalid patterns
+func parseIgnoreRules(source, base, contents string) ignoreRules {
+	var rules ignoreRules
+	for i, line := range strings.Split(contents, "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: base}
+		if strings.HasPrefix(line, "!") {
+			rule.negated = true
+			line = line[1:]
+		}
+		// a leading \ escapes a literal # or !
+		line = strings.TrimPrefix(line, `\`)
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		line = strings.TrimPrefix(line, "/")
+		if line == "" {
+			continue
+		}
+		rule.segments = strings.Split(line, "/")
+		if _, err := path.Match(line, ""); err != nil {
+			fmt.Printf("plain: %s:%d: invalid pattern %q, ignoring it\n", source, i+1, line)
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return rules
+}
+
+// reads the .plainignore of dir, declared at base, if there is one
+func readIgnoreRules(dir, base string) (ignoreRules, error) {
+	filename := filepath.Join(dir, PLAINIGNORE)
+	b, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return parseIgnoreRules(filename, base, string(b)), nil
+}
+
+// reports whether rel, the slash-separated path of a file (or directory) relative to the copied directory, is ignored
+func (rules ignoreRules) ignored(rel string, isDir bool) bool {
+	var ignored bool
+	for _, rule := range rules {
+		if rule.matches(rel, isDir) {
+			ignored = !rule.negated
+		}
+	}
+	return ignored
+}
+
+func (rule ignoreRule) matches(rel string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if rule.base != "" {
+		if !strings.HasPrefix(rel, rule.base+"/") {
+			return false
+		}
+		rel = strings.TrimPrefix(rel, rule.base+"/")
+	}
+	if !rule.anchored {
+		// patterns without a / match the name of a file at any depth
+		matched, _ := path.Match(rule.segments[0], path.Base(rel))
+		return matched
+	}
+	return matchSegments(rule.segments, strings.Split(rel, "/"))
+}
+
+// matches the segments of a pattern against those of a path, where ** matches any number of segments (a trailing **
+// matches everything inside a directory, but not the directory itself)
+func matchSegments(pattern, segments []string) bool {
+	if len(pattern) == 0 {
+		return len(segments) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return len(segments) > 0
+		}
+		for i := 0; i <= len(segments); i++ {
+			if matchSegments(pattern[1:], segments[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(segments) == 0 {
+		return false
+	}
+	matched, _ := path.Match(pattern[0], segments[0])
+	return matched && matchSegments(pattern[1:], segments[1:])
+}
+
+// the default rules, followed by those of the site's .plainignore
+func siteIgnoreRules() (ignoreRules, error) {
+	rules := parseIgnoreRules("default ignore rules", "", DEFAULT_IGNORE)
+	site, err := readIgnoreRules(".", "")
+	if err != nil {
+		return nil, err
+	}
+	return append(rules, site...), nil
+}
+
+// copies are synced rather than repeated: files whose size & modification time (or, with copy-compare hash, contents)
+// match their previous copy are left alone, and copies keep the modification time & permissions of their source.
+// copy-symlinks decides whether symlinks are followed, copied as links, or skipped. plain remembers the files it copied
+// into each directory in copy-store.json, so that copy-delete removes the copies of files removed from the source (or
+// newly ignored) without touching anything else in the directory, e.g. pages written into it
+
+// structure of copy-store.json:
+// {
+//  <directory copied into> : [<paths of the files & links copied into it, relative to it>, ..]
+//  ..
+// }
+const COPY_STORE = "copy-store.json"
+
+var copymap map[string][]string
+
+func openCopyStore() map[string][]string {
+	b, err := os.ReadFile(COPY_STORE)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string][]string)
+	}
+	util.Check(err)
+	var v map[string][]string
+	err = json.Unmarshal(b, &v)
+	util.Check(err)
+	// saving a nil map (before anything was copied) stores null
+	if v == nil {
+		v = make(map[string][]string)
+	}
+	return v
+}
+
+func saveCopyStore(copymap map[string][]string) error {
+	b, err := json.MarshalIndent(copymap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save store: could not marshal map %w", err)
+	}
+	err = os.WriteFile(COPY_STORE, b, 0666)
+	if err != nil {
+		return fmt.Errorf("save store: could not save %s %w", COPY_STORE, err)
+	}
+	return nil
+}
+
+// how copies are compared with their source: by size & modification time, or by size & contents
+func copyCompare() string {
+	switch mode := configString("copy-compare", "mtime"); mode {
+	case "mtime", "hash":
+		return mode
+	default:
+		log.Fatalln(fmt.Sprintf("config: copy-compare expects mtime or hash, got %q", mode))
+	}
+	return ""
+}
+
+// what's copied for a symlink: the file or directory it points at, the link itself, or nothing
+func copySymlinks() string {
+	switch mode := configString("copy-symlinks", "follow"); mode {
+	case "follow", "link", "skip":
+		return mode
+	default:
+		log.Fatalln(fmt.Sprintf("config: copy-symlinks expects follow, link or skip, got %q", mode))
+	}
+	return ""
+}
+
+type copyJob struct {
+	compare  string          // see copyCompare
+	symlinks string          // see copySymlinks
+	copied   map[string]bool // the files & links copied (or already up to date), relative to the copied directory
+	updated  int             // the number of files & links written
+	skipped  []string        // the ignored (or skipped symlink) paths, relative to the copied directory
+	copying  []string        // the resolved paths of the directories being copied, to catch symlinks looping back
+}
+
+// Copy the contents of a directory to the webroot, preserving the directory's basename.
+// Traverses readDir, syncing files to the writeDir (of the form: filepath.Join(OUTPATH, filepath.Base(readDir))),
+// skipping the files matched by .plainignore rules
+func CopyDirectory(readDir, writeDir, rewrittenDest string) error {
+	base := filepath.Base(readDir)
+	if rewrittenDest != "" {
+		base = rewrittenDest
+	}
+	dst := filepath.Join(writeDir, base)
+	rules, err := siteIgnoreRules()
+	if err != nil {
+		return err
+	}
+	job := &copyJob{compare: copyCompare(), symlinks: copySymlinks(), copied: make(map[string]bool)}
+	err = job.copyTree(readDir, dst, "", rules)
+	if err != nil {
+		return err
+	}
+	echo(fmt.Sprintf("synced %s to %s: %d of %d files written", readDir, dst, job.updated, len(job.copied)))
+	if len(job.skipped) > 0 {
+		fmt.Printf("plain: %s: skipped %s\n", readDir, summarizePaths(job.skipped))
+	}
+
+	// remember what was copied, including (unless they're deleted) the copies of files no longer in the source
+	var stale []string
+	for _, rel := range copymap[dst] {
+		if !job.copied[rel] {
+			stale = append(stale, rel)
+		}
+	}
+	if configBool("copy-delete", false) {
+		removed, err := removeStale(dst, stale)
+		if err != nil {
+			return err
+		}
+		if len(removed) > 0 {
+			fmt.Printf("plain: %s: removed %s, no longer copied from %s\n", dst, summarizePaths(removed), readDir)
+		}
+		stale = nil
+	}
+	var manifest []string
+	for rel := range job.copied {
+		manifest = append(manifest, rel)
+	}
+	manifest = append(manifest, stale...)
+	sort.Strings(manifest)
+	copymap[dst] = manifest
+	return nil
+}
+
+// syncs the directory src to dst, where rel is src's path relative to the copied directory
+func (job *copyJob) copyTree(src, dst, rel string, rules ignoreRules) error {
+	local, err := readIgnoreRules(src, rel)
+	if err != nil {
+		return err
+	}
+	// copy the rules before extending them, so that sibling directories don't see each other's rules
+	rules = append(append(ignoreRules{}, rules...), local...)
+	resolved, err := filepath.EvalSymlinks(src)
+	if err != nil {
+		return err
+	}
+	for _, dir := range job.copying {
+		if dir == resolved {
+			return fmt.Errorf("copy %s: symlink loops back to %s, which is being copied already", src, resolved)
+		}
+	}
+	job.copying = append(job.copying, resolved)
+	defer func() { job.copying = job.copying[:len(job.copying)-1] }()
+	files, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+	// replace whatever isn't a directory at dst, e.g. a file or a symlink copied by a previous build
+	if current, err := os.Lstat(dst); err == nil && !current.IsDir() {
+		err = os.Remove(dst)
+		if err != nil {
+			return err
+		}
+	}
+	err = os.MkdirAll(dst, 0777)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		srcpath := filepath.Join(src, f.Name())
+		dstpath := filepath.Join(dst, f.Name())
+		fileRel := path.Join(rel, f.Name())
+		info, err := os.Lstat(srcpath)
+		if err != nil {
+			return err
+		}
+		symlink := info.Mode()&os.ModeSymlink != 0
+		if symlink && job.symlinks == "follow" {
+			info, err = os.Stat(srcpath)
+			if err != nil {
+				return err
+			}
+		}
+		if rules.ignored(fileRel, info.IsDir()) {
+			if info.IsDir() {
+				fileRel += "/"
+			}
+			echo("skipping", srcpath)
+			job.skipped = append(job.skipped, fileRel)
+			continue
+		}
+		switch {
+		case symlink && job.symlinks == "skip":
+			echo("skipping symlink", srcpath)
+			job.skipped = append(job.skipped, fileRel+" (symlink)")
+		case symlink && job.symlinks == "link":
+			err = job.copyLink(srcpath, dstpath, fileRel)
+		case info.IsDir():
+			err = job.copyTree(srcpath, dstpath, fileRel, rules)
+		default:
+			err = job.syncFile(srcpath, dstpath, fileRel, info)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	// set last, so that a read-only source directory doesn't keep its files from being copied. the copy stays
+	// writable by its owner, or the next build (and any page written into it) would fail
+	return os.Chmod(dst, srcInfo.Mode().Perm()|0700)
+}
+
+// copies the file src to dst, unless dst is an up to date copy of it
+func (job *copyJob) syncFile(src, dst, rel string, info os.FileInfo) error {
+	job.copied[rel] = true
+	if current, err := os.Lstat(dst); err == nil {
+		if current.Mode().IsRegular() {
+			unchanged, err := job.unchanged(src, dst, info, current)
+			if err != nil {
+				return err
+			}
+			if unchanged {
+				return preserveAttributes(dst, info, current)
+			}
+		}
+		// replace the previous copy rather than write through it: it may be read-only, a symlink, or a directory
+		err = os.RemoveAll(dst)
+		if err != nil {
+			return err
+		}
+	}
+	err := copyFile(src, dst)
+	if err != nil {
+		return err
+	}
+	job.updated++
+	return preserveAttributes(dst, info, nil)
+}
+
+// reports whether the copy at dst matches its source at src
+func (job *copyJob) unchanged(src, dst string, info, current os.FileInfo) (bool, error) {
+	if info.Size() != current.Size() {
+		return false, nil
+	}
+	if job.compare == "mtime" {
+		// compared in seconds, as not every file system stores finer modification times
+		return info.ModTime().Truncate(time.Second).Equal(current.ModTime().Truncate(time.Second)), nil
+	}
+	srcHash, err := fileHash(src)
+	if err != nil {
+		return false, err
+	}
+	dstHash, err := fileHash(dst)
+	if err != nil {
+		return false, err
+	}
+	return srcHash == dstHash, nil
+}
+
+// gives the copy at dst the permissions & modification time of its source, unless the copy (current) already has them.
+// like copied directories, copied files stay writable by their owner
+func preserveAttributes(dst string, info, current os.FileInfo) error {
+	perm := info.Mode().Perm() | 0600
+	if current == nil || current.Mode().Perm() != perm {
+		err := os.Chmod(dst, perm)
+		if err != nil {
+			return err
+		}
+	}
+	if current == nil || !current.ModTime().Equal(info.ModTime()) {
+		return os.Chtimes(dst, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
+
+// copies the symlink src as a symlink to the same target, unless dst already is one
+func (job *copyJob) copyLink(src, dst, rel string) error {
+	job.copied[rel] = true
+	target, err := os.Readlink(src)
+	if err != nil {
+		return err
+	}
+	if current, err := os.Readlink(dst); err == nil && current == target {
+		return nil
+	}
+	if _, err := os.Lstat(dst); err == nil {
+		err = os.RemoveAll(dst)
+		if err != nil {
+			return err
+		}
+	}
+	job.updated++
+	return os.Symlink(target, dst)
+}
+
+// removes the copies of files that are no longer copied into dst, along with the directories left empty, returning
+// the paths removed
+func removeStale(dst string, stale []string) ([]string, error) {
+	var removed []string
+	for _, rel := range stale {
+		// the store is only written by plain, but never let it point outside of the copied directory
+		if rel = path.Clean(rel); path.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, "../") {
+			continue
+		}
+		filename := filepath.Join(dst, filepath.FromSlash(rel))
+		// already gone, or replaced by a directory of the source
+		if info, err := os.Lstat(filename); err != nil || info.IsDir() {
+			continue
+		}
+		err := os.Remove(filename)
+		if err != nil {
+			return removed, err
+		}
+		echo("removed", filename)
+		removed = append(removed, rel)
+		// remove the directories that held only the removed file; os.Remove fails on those that still hold something
+		for dir := filepath.Dir(filename); dir != dst && strings.HasPrefix(dir, dst); dir = filepath.Dir(dir) {
+			if os.Remove(dir) != nil {
+				break
+			}
+		}
+	}
+	return removed, nil
+}
+
+// lists the first few paths, and counts the rest
+func summarizePaths(paths []string) string {
+	const shown = 5
+	noun := "entries"
+	if len(paths) == 1 {
+		noun = "entry"
+	}
+	if len(paths) <= shown {
+		return fmt.Sprintf("%d %s: %s", len(paths), noun, strings.Join(paths, ", "))
+	}
+	return fmt.Sprintf("%d %s: %s, and %d more", len(paths), noun, strings.Join(paths[:shown], ", "), len(paths)-shown)
+}
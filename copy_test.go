@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// copies of read-only directories & files stay writable by their owner, build after build
+func TestCopyReadOnlyDirectory(t *testing.T) {
+	inSite(t, map[string]string{"static/docs/notes.txt": "notes"})
+	previousStore := copymap
+	copymap = make(map[string][]string)
+	defer func() { copymap = previousStore }()
+	for _, name := range []string{"static/docs/notes.txt", "static/docs", "static"} {
+		if err := os.Chmod(name, 0555); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer os.Chmod(filepath.Join("static", "docs"), 0755)
+	defer os.Chmod("static", 0755)
+
+	for build := 0; build < 2; build++ {
+		if err := CopyDirectory("static", "web", ""); err != nil {
+			t.Fatalf("build %d: %v", build, err)
+		}
+		for name, want := range map[string]os.FileMode{"web/static": 0755, "web/static/docs": 0755, "web/static/docs/notes.txt": 0755} {
+			info, err := os.Stat(name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if info.Mode().Perm() != want {
+				t.Errorf("build %d: expected %s to have mode %v, got %v", build, name, want, info.Mode().Perm())
+			}
+		}
+	}
+	// a page written into the copy
+	if err := os.WriteFile(filepath.Join("web", "static", "docs", "index.html"), []byte("<p>docs</p>"), 0666); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// the copy store survives being saved & reopened whatever it held before, including null (saved from a nil map)
+func TestCopyStoreRoundTrip(t *testing.T) {
+	tests := []struct {
+		name     string
+		store    string // the contents of copy-store.json, or "" if there is none
+		previous map[string][]string
+	}{
+		{"no store", "", nil},
+		{"null", "null", nil},
+		{"empty", "{}", nil},
+		{"previous copies", `{"web/demo": ["demo.css"]}`, map[string][]string{"web/demo": {"demo.css"}}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			files := map[string]string{}
+			if test.store != "" {
+				files[COPY_STORE] = test.store
+			}
+			inSite(t, files)
+			store := openCopyStore()
+			store["web/static"] = []string{"style.css", "img/logo.png"}
+			if err := saveCopyStore(store); err != nil {
+				t.Fatal(err)
+			}
+			want := map[string][]string{"web/static": {"style.css", "img/logo.png"}}
+			for dir, copies := range test.previous {
+				want[dir] = copies
+			}
+			if got := openCopyStore(); !reflect.DeepEqual(got, want) {
+				t.Errorf("expected the reopened store to hold %v, got %v", want, got)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ module github.com/cblgh/plain
 go 1.16
 
 require (
+	github.com/alecthomas/chroma/v2 v2.3.0
 	github.com/golang/freetype v0.0.0-20170609003504-e2365dfdc4a0
 	github.com/gomarkdown/markdown v0.0.0-20210514010506-3b9f47219fe7
 	golang.org/x/image v0.0.0-20220321031419-a8550c1d254a
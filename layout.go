@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"github.com/cblgh/plain/util"
+	"html/template"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// layout mode: instead of splicing pages into header.html & footer.html, each page is rendered by executing an
+// html/template layout (set with the layout key in the config file) on the page's PageData. individual routes and
+// listicle entries may select a different layout by name (ly <name>), which is looked up in the templates directory
+
+type NavItem struct {
+	Link, Text string
+	Current    bool // the item links to the page itself
+	Active     bool // the item links to the page, or one of its ancestors
+	Children   []NavItem
+}
+
+type Feed struct {
+	Name, Description, Link string
+}
+
+type PageTheme struct {
+	Foreground, Background, Link string
+}
+
+// the data available to layout templates, e.g. {{.Title}} or {{range .Nav}}
+type PageData struct {
+	Title, Brief string // plain text
+	SiteTitle    string // set by site-title in the config file
+	Route        string // the route the page is rendered at, e.g. /articles/trustnet
+	Back         NavItem
+	Breadcrumbs  []NavItem // empty unless breadcrumbs are enabled; the last crumb is the page itself
+	Nav          []NavItem
+	Feeds        []Feed
+	Theme        PageTheme
+	Background   string
+
+	Metadata   template.HTML // meta tags: description, open graph previews, structured data
+	Style      template.HTML // <style> elements applying the background image and theme
+	Content    template.HTML
+	Properties template.HTML // the microformats2 h-entry properties of articles
+
+	Article             bool // whether the page was rendered from a markdown file, as opposed to being a listicle
+	Published, Modified time.Time
+}
+
+var siteFeeds []feedDescription
+
+func newPageData(pf PageFragment, content string) PageData {
+	data := PageData{
+		Title:      pf.title,
+		Brief:      pf.brief,
+		SiteTitle:  configString("site-title", ""),
+		Route:      pf.route,
+		Theme:      PageTheme{Foreground: pf.theme.foreground, Background: pf.theme.background, Link: pf.theme.link},
+		Background: pf.background,
+		Metadata:   template.HTML(pageMetadata(pf)),
+		Style:      template.HTML(backgroundStyle(pf) + themeStyle(pf)),
+		Content:    template.HTML(content),
+		Article:    pf.article,
+		Published:  pf.published,
+		Modified:   pf.modified,
+	}
+	if pf.article {
+		data.Properties = template.HTML(entryProperties(pf))
+	}
+	data.Back.Link, data.Back.Text = backLink(pf)
+	data.Nav = navItems(navElements, pf)
+	for _, crumb := range breadcrumbs(pf) {
+		data.Breadcrumbs = append(data.Breadcrumbs, NavItem{Link: crumb.link, Text: crumb.text, Current: crumb.link == ""})
+	}
+	for _, feed := range siteFeeds {
+		data.Feeds = append(data.Feeds, Feed{Name: feed.name, Description: feed.description, Link: fmt.Sprintf("/%s.xml", feed.name)})
+	}
+	return data
+}
+
+func navItems(items []navigation, pf PageFragment) []NavItem {
+	var converted []NavItem
+	for _, nav := range items {
+		current, _ := navState(nav.link, pf)
+		converted = append(converted, NavItem{
+			Link:     routeLink(nav.link),
+			Text:     nav.text,
+			Current:  current,
+			Active:   nav.active(pf),
+			Children: navItems(nav.children, pf),
+		})
+	}
+	return converted
+}
+
+// parsed layouts, keyed by their path
+var layouts = make(map[string]*template.Template)
+
+func getLayout(path string) *template.Template {
+	if t, exists := layouts[path]; exists {
+		return t
+	}
+	source, err := readTemplate(path, DEFAULT_LAYOUT)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	t, err := template.New(path).Parse(source)
+	if err != nil {
+		log.Fatalln(fmt.Errorf("layout: could not parse %s %w", path, err))
+	}
+	layouts[path] = t
+	return t
+}
+
+// layouts are named after a file of the templates directory, and can't reach outside of it
+func validLayoutName(name string) bool {
+	return name != "" && !strings.Contains(name, "..") && !strings.ContainsAny(name, `/\`+string(filepath.Separator))
+}
+
+// returns the path of the named layout, e.g. articles -> templates/articles.html
+func namedLayout(name string) string {
+	if !validLayoutName(name) {
+		log.Fatalln(fmt.Errorf("layout: %q is not a layout name; layouts are named after a file in the templates directory, e.g. ly articles", name))
+	}
+	path := filepath.Join(configString("templates", "templates"), fmt.Sprintf("%s.html", name))
+	if _, err := os.Stat(path); err != nil {
+		log.Fatalln(fmt.Errorf("layout: could not find a layout named %q %w", name, err))
+	}
+	return path
+}
+
+func renderLayout(path string, pf PageFragment, content string) string {
+	var out strings.Builder
+	err := getLayout(path).Execute(&out, newPageData(pf, content))
+	util.Check(err)
+	return out.String()
+}
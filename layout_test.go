@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestValidLayoutName(t *testing.T) {
+	tests := []struct {
+		name  string
+		valid bool
+	}{
+		{"articles", true},
+		{"long-read", true},
+		{"v1.2", true},
+		{"", false},
+		{"..", false},
+		{"../../etc/passwd", false},
+		{"../secrets", false},
+		{"drafts/article", false},
+		{"/etc/passwd", false},
+		{`..\windows`, false},
+		{`drafts\article`, false},
+	}
+	for _, test := range tests {
+		if got := validLayoutName(test.name); got != test.valid {
+			t.Errorf("expected validLayoutName(%q) to be %v, got %v", test.name, test.valid, got)
+		}
+	}
+}
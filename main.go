@@ -11,13 +11,19 @@ package main
 // project name: plain
 import (
 	_ "embed"
+	"encoding/json"
 	"errors"
 	"flag"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
 	"fmt"
 	"github.com/cblgh/plain/og"
 	"github.com/cblgh/plain/rss"
 	"github.com/cblgh/plain/util"
-	"github.com/gomarkdown/markdown"
+	"html"
 	"io"
 	"io/fs"
 	"net/url"
@@ -27,6 +33,7 @@ import (
 	"path/filepath"
 	"regexp"
 	"sort"
+	"strconv"
 	"strings"
 	"time"
 )
@@ -70,6 +77,12 @@ func echo(s ...interface{}) {
 // gt git repo
 // br git branch
 // vb verbatim - verbatim copy a file and dump it at destination
+// pi preview image - use the given image as the page's link preview, instead of generating one
+// ly layout - render the page with the named layout from the templates directory
+// mx markdown extensions - enable (or, prefixed with -, disable) markdown extensions for the page
+// ng navigation group - nest the navigation item under the navigation item (or label) of the given title
+// no navigation order - sort the navigation item by the given number instead of by its position in the index
+// tc table of contents - toggle (true or false) the table of contents of the page's markdown
 
 const (
 	/* tt */ TITLE = iota
@@ -94,6 +107,12 @@ const (
 	/* sl */ LINK_COLOR
 	/* gt */ GIT_REPO
 	/* br */ GIT_BRANCH
+	/* pi */ PREVIEW_IMAGE
+	/* ly */ LAYOUT
+	/* mx */ MARKDOWN_EXTENSIONS
+	/* ng */ NAVIGATION_GROUP
+	/* no */ NAVIGATION_ORDER
+	/* tc */ TABLE_OF_CONTENTS
 	/* xx */ NOIDEA
 )
 
@@ -122,9 +141,18 @@ type PageFragment struct {
 	underParent				 bool
 	title, brief, link string
 	background         string
+	headerImage        string // web path of the header image
+	preview            string // path to an image to use as the link preview, copied into /og
+	layout             string // name of the layout the page is rendered with; the site-wide layout is used if empty
+	markdown           string // markdown extensions enabled (or disabled) for the page, e.g. "footnotes -smartypants"
+	toc                string // whether the page gets a table of contents ("true" or "false"); decided by the config if empty
 	webpath, contents  string
+	route              string // the route the page fragment is itself rendered at, e.g. /articles/trustnet
 	location           string
 	metadata					 []string
+	article            bool      // the page was rendered from a markdown file, as opposed to a listicle
+	published          time.Time // for articles: when the article was first published
+	modified           time.Time // for articles: when the article's markdown file was last changed
 }
 
 type Page struct {
@@ -136,12 +164,15 @@ type Page struct {
 
 type mdFile struct {
 	contents string
-	images   []string // slice of image paths, for later copying
+	outline  // the title, summary & headings of the file
 }
 
 type navigation struct {
-	link string
-	text string
+	link     string
+	text     string
+	group    string // title of the navigation item this item is nested under
+	order    int
+	children []navigation
 }
 
 func parseSymbols() {
@@ -194,6 +225,18 @@ func parseSymbols() {
 			return GIT_REPO
 		case "GIT_BRANCH":
 			return GIT_BRANCH
+		case "PREVIEW_IMAGE":
+			return PREVIEW_IMAGE
+		case "LAYOUT":
+			return LAYOUT
+		case "MARKDOWN_EXTENSIONS":
+			return MARKDOWN_EXTENSIONS
+		case "NAVIGATION_GROUP":
+			return NAVIGATION_GROUP
+		case "NAVIGATION_ORDER":
+			return NAVIGATION_ORDER
+		case "TABLE_OF_CONTENTS":
+			return TABLE_OF_CONTENTS
 		default:
 			return NOIDEA
 		}
@@ -219,6 +262,97 @@ func symbol(line string) int {
 	return NOIDEA
 }
 
+// reads the site-wide settings from the config file. like the symbols file, each line is a key followed by its value,
+// and lines starting with // are skipped
+func parseConfig() {
+	config = make(map[string]string)
+	input, err := os.ReadFile("config")
+	util.Check(err)
+	for _, line := range strings.Split(string(input), "\n") {
+		line = strings.TrimSpace(line)
+		if len(line) == 0 || strings.HasPrefix(line, "//") {
+			continue
+		}
+		key := strings.Fields(line)[0]
+		config[key] = strings.TrimSpace(line[len(key):])
+	}
+}
+
+func configString(key, fallback string) string {
+	if value, exists := config[key]; exists {
+		return value
+	}
+	return fallback
+}
+
+func configFloat(key string, fallback float64) float64 {
+	value, exists := config[key]
+	if !exists {
+		return fallback
+	}
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("config: %s expects a number, got %q", key, value))
+	}
+	return f
+}
+
+func configInt(key string, fallback int) int {
+	return int(configFloat(key, float64(fallback)))
+}
+
+func configBool(key string, fallback bool) bool {
+	value, exists := config[key]
+	if !exists {
+		return fallback
+	}
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("config: %s expects true or false, got %q", key, value))
+	}
+	return b
+}
+
+func configColor(key string, fallback color.RGBA) color.RGBA {
+	value, exists := config[key]
+	if !exists {
+		return fallback
+	}
+	c, err := og.ParseColor(value)
+	if err != nil {
+		log.Fatalln(fmt.Sprintf("config: %s %v", key, err))
+	}
+	return c
+}
+
+// the default preview settings, as overridden by the og-* keys of the config file
+func previewSettings() og.Settings {
+	settings := og.GetDefaultSettings()
+	settings.TitleFont = configString("og-title-font", settings.TitleFont)
+	settings.BaseFont = configString("og-base-font", settings.BaseFont)
+	settings.Size = configFloat("og-size", settings.Size)
+	settings.TitleMultiplier = configFloat("og-title-multiplier", settings.TitleMultiplier)
+	settings.Spacing = configFloat("og-spacing", settings.Spacing)
+	settings.DPI = configFloat("og-dpi", settings.DPI)
+	settings.Width = configInt("og-width", settings.Width)
+	settings.Height = configInt("og-height", settings.Height)
+	settings.Padding = configInt("og-padding", settings.Padding)
+	settings.Foreground = configColor("og-foreground", settings.Foreground)
+	settings.Background = configColor("og-background", settings.Background)
+	settings.Footer = configString("og-footer", settings.Footer)
+	settings.Template = configString("og-template", settings.Template)
+	settings.Logo = configString("og-logo", settings.Logo)
+	settings.LogoSize = configInt("og-logo-size", settings.LogoSize)
+	validTemplate := false
+	for _, template := range og.Templates {
+		validTemplate = validTemplate || template == settings.Template
+	}
+	if !validTemplate {
+		log.Fatalln(fmt.Sprintf("config: og-template expects one of %s, got %q", strings.Join(og.Templates, ", "), settings.Template))
+	}
+	return settings
+}
+
 func (page Page) produceHeader() []string {
 	if len(page.headerContent) == 0 {
 		return []string{}
@@ -230,24 +364,6 @@ func (page Page) produceHeader() []string {
   `, strings.Join(page.headerContent, "\n"))}
 }
 
-var markdownImagePattern = regexp.MustCompile(`[!]\[.*\]\((\S+)\)`)
-
-func extractImagePaths(content []byte) []string {
-	s := string(content)
-	var paths []string
-	matches := markdownImagePattern.FindAllStringSubmatch(s, -1)
-	if len(matches) > 0 {
-		for _, match := range matches {
-			// discard http[s]? matches; we can't very well copy them :)
-			if strings.HasPrefix(match[1], "https://") || strings.HasPrefix(match[1], "http://") {
-				continue
-			}
-			paths = append(paths, match[1])
-		}
-	}
-	return paths
-}
-
 var wikilinksPattern = regexp.MustCompile(`(\[\[(.*?)\]\])`)
 
 // TODO (2026-05-22): improve this to actually search for the article instead
@@ -258,14 +374,39 @@ func transformWikilinks(content []byte) []byte {
 	// search and replace all instances of [[wiki]] syntax with a flat link to the subject e.g. /wiki
 	if len(matches) > 0 {
 		for _, match := range matches {
-			s = strings.ReplaceAll(s, match[1], fmt.Sprintf(`<a href="/%s">%s</a>`, strings.ToLower(match[2]), match[2]))
+			s = strings.ReplaceAll(s, match[1], fmt.Sprintf(`<a href="%s">%s</a>`, html.EscapeString(wikilinkTarget(match[2])), escapeMarkdown(match[2])))
 		}
 	}
 	return []byte(s)
 }
 
+var markdownEscaper = strings.NewReplacer(`\`, `\\`, "`", "\\`", `*`, `\*`, `_`, `\_`, `[`, `\[`, `]`, `\]`, `<`, `\<`, `>`, `\>`, `&`, `\&`)
+
+// escapes s for use as literal text in markdown. the text of a wikilink is rendered as markdown, which escapes
+// html by itself, so it's backslash-escaped rather than html-escaped (which would escape it twice)
+func escapeMarkdown(s string) string {
+	return markdownEscaper.Replace(s)
+}
+
+// the link a wikilink points at: [[wiki]] -> /wiki, [[wiki#A section]] -> /wiki#a-section, [[#notes]] -> #notes
+func wikilinkTarget(subject string) string {
+	page, section := subject, ""
+	if i := strings.Index(subject, "#"); i != -1 {
+		page, section = subject[:i], subject[i+1:]
+	}
+	var target string
+	if page != "" {
+		target = routeLink(strings.ToLower(strings.TrimSpace(page)))
+	}
+	if section != "" {
+		target += "#" + slugify(section)
+	}
+	return target
+}
+
 func markup(s string) string {
-	return string(markdown.ToHTML([]byte(strings.TrimSpace(s)), nil, nil))
+	b, _ := renderMarkdown([]byte(strings.TrimSpace(s)), markdownSettings(""))
+	return string(b)
 }
 
 func (pf PageFragment) assemble() string {
@@ -273,17 +414,18 @@ func (pf PageFragment) assemble() string {
 	if len(pf.title) == 0 {
 		return ""
 	}
+	// each entry is marked up as a microformats2 h-entry, nested in the listicle's h-feed
 	if len(pf.link) > 0 {
 		return fmt.Sprintf(
-			`<dt><a href="%s">%s</a></dt>
-    <dd>%s</dd>
+			`<div class="h-entry"><dt><a class="p-name u-url" href="%s">%s</a></dt>
+    <dd class="p-summary">%s</dd></div>
    `,
-			pf.link, pf.title, markup(pf.brief))
+			html.EscapeString(pf.link), html.EscapeString(pf.title), markup(pf.brief))
 	} else {
 		return fmt.Sprintf(`
-    <dt>%s</dt>
-    <dd>%s</dd>`,
-			pf.title, markup(pf.brief))
+    <div class="h-entry"><dt class="p-name">%s</dt>
+    <dd class="p-summary">%s</dd></div>`,
+			html.EscapeString(pf.title), markup(pf.brief))
 	}
 }
 
@@ -301,37 +443,74 @@ func readTemplate(template, defaultContent string) (string, error) {
 
 var titlePattern = regexp.MustCompile(`(<title>(.*)<\/title>)`)
 
-func htmlContent(content string) string {
-	return fmt.Sprintf("<main><article>%s</article></main>", content)
+func htmlContent(pf PageFragment, content string) string {
+	if !pf.article {
+		return fmt.Sprintf("<main><article>%s</article></main>", content)
+	}
+	return fmt.Sprintf(`<main><article class="h-entry">%s<div class="e-content">%s</div></article></main>`, entryProperties(pf), content)
 }
 
-func htmlPreamble(pf PageFragment) string {
-	prevRoute := pf.webpath
-	var mainNav string
+// mark articles up as a microformats2 h-entry. the name, summary, url and dates aren't part of the visible
+// content, so they are conveyed with empty elements that only carry attributes
+func entryProperties(pf PageFragment) string {
+	var properties []string
+	if pf.title != "" {
+		properties = append(properties, fmt.Sprintf(`<data class="p-name" value="%s"></data>`, html.EscapeString(pf.title)))
+	}
+	if pf.brief != "" {
+		properties = append(properties, fmt.Sprintf(`<data class="p-summary" value="%s"></data>`, html.EscapeString(pf.brief)))
+	}
+	if host != "" {
+		properties = append(properties, fmt.Sprintf(`<data class="u-url" value="%s"></data>`, html.EscapeString(util.ConstructURL(canonicalUrl, routeLink(pf.route)))))
+	}
+	if !pf.published.IsZero() {
+		properties = append(properties, fmt.Sprintf(`<time class="dt-published" datetime="%s"></time>`, pf.published.Format(time.RFC3339)))
+	}
+	if !pf.modified.IsZero() {
+		properties = append(properties, fmt.Sprintf(`<time class="dt-updated" datetime="%s"></time>`, pf.modified.Format(time.RFC3339)))
+	}
+	return strings.Join(properties, "")
+}
 
-	if prevRoute != "" {
-		returnName := strings.TrimPrefix(prevRoute, "/")
-		if returnName == "" {
-			returnName = "home"
-		}
-		mainNav += fmt.Sprintf(`<li><a href="%s">Back to %s</a></li>`, prevRoute, returnName)
-	} else {
-		mainNav = "<li></li> "
+type articleSchema struct {
+	Context       string `json:"@context"`
+	Type          string `json:"@type"`
+	Headline      string `json:"headline"`
+	Description   string `json:"description,omitempty"`
+	DatePublished string `json:"datePublished,omitempty"`
+	DateModified  string `json:"dateModified,omitempty"`
+	URL           string `json:"url,omitempty"`
+}
+
+// describes an article page as a schema.org Article, returned as a JSON-LD script tag
+func articleStructuredData(pf PageFragment) string {
+	schema := articleSchema{Context: "https://schema.org", Type: "Article", Headline: pf.title, Description: pf.brief}
+	if !pf.published.IsZero() {
+		schema.DatePublished = pf.published.Format(time.RFC3339)
 	}
-	for _, nav := range navElements {
-		if nav.text == "" {
-			continue
-		}
-		mainNav += fmt.Sprintf(`<li><a href="%s">%s</a></li>`, nav.link, nav.text)
+	if !pf.modified.IsZero() {
+		schema.DateModified = pf.modified.Format(time.RFC3339)
 	}
-	header, err := readTemplate("header.html", DEFAULT_HEADER)
-	if err != nil {
-		log.Fatalln(err)
+	if host != "" {
+		schema.URL = util.ConstructURL(canonicalUrl, routeLink(pf.route))
 	}
+	// json.Marshal escapes <, > and &, so the output can't break out of the script element
+	b, err := json.Marshal(schema)
+	util.Check(err)
+	return fmt.Sprintf(`<script type="application/ld+json">%s</script>`, b)
+}
 
-	// add background image to an article if it has been set
-	const backgroundSentinel = "<!-- background -->"
-	const themeSentinel = "<!-- theme -->"
+// the link back to the page's parent, and its text (e.g. "home")
+func backLink(pf PageFragment) (string, string) {
+	prevRoute := pf.webpath
+	if prevRoute == "" {
+		return "", ""
+	}
+	return routeLink(prevRoute), routeLabel(prevRoute)
+}
+
+// the style overriding the page's background image, if it has been set
+func backgroundStyle(pf PageFragment) string {
 	const backgroundTemplate = `
   <style>
   html {
@@ -339,84 +518,226 @@ func htmlPreamble(pf PageFragment) string {
   }
   </style>
   `
-	if pf.background != "" {
-		bg := fmt.Sprintf(backgroundTemplate, pf.background)
-		header = strings.ReplaceAll(header, backgroundSentinel, bg)
-	} else {
-		header = strings.ReplaceAll(header, backgroundSentinel, "")
+	if pf.background == "" {
+		return ""
 	}
-	if pf.theme.foreground != "" || pf.theme.background != "" || pf.theme.link != "" {
-		var theme string
-		if pf.theme.foreground != "" {
-			theme += fmt.Sprintf("--foreground: %s !important;", pf.theme.foreground)
+	return fmt.Sprintf(backgroundTemplate, cssString(pf.background))
+}
+
+// escapes s for use inside a double-quoted css string, such that it can't terminate the string or the <style> element
+func cssString(s string) string {
+	var b strings.Builder
+	for _, r := range s {
+		switch r {
+		case '"', '\\', '<', '>', '\n', '\r':
+			fmt.Fprintf(&b, "\\%x ", r)
+		default:
+			b.WriteRune(r)
 		}
-		if pf.theme.background != "" {
-			theme += fmt.Sprintf("--background: %s !important;", pf.theme.background)
+	}
+	return b.String()
+}
+
+// strips the characters that would let a css value (e.g. a theme color) escape its declaration or the <style> element.
+// values that load or run something (url(), expression(), javascript:) are never colors, and are dropped entirely
+func cssValue(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(";{}<>\"'\\\n\r", r) {
+			return -1
 		}
-		if pf.theme.link != "" {
-			theme += fmt.Sprintf("--highlight: %s !important;", pf.theme.link)
+		return r
+	}, s)
+	lower := strings.ToLower(s)
+	for _, unsafe := range []string{"url(", "expression(", "javascript:"} {
+		if strings.Contains(lower, unsafe) {
+			return ""
 		}
+	}
+	return strings.TrimSpace(s)
+}
+
+// the style overriding the site's colors with the page's theme, if any of its colors have been set
+func themeStyle(pf PageFragment) string {
+	foreground, background, link := cssValue(pf.theme.foreground), cssValue(pf.theme.background), cssValue(pf.theme.link)
+	if foreground == "" && background == "" && link == "" {
+		return ""
+	}
+	var theme string
+	if foreground != "" {
+		theme += fmt.Sprintf("--foreground: %s !important;", foreground)
+	}
+	if background != "" {
+		theme += fmt.Sprintf("--background: %s !important;", background)
+	}
+	if link != "" {
+		theme += fmt.Sprintf("--highlight: %s !important;", link)
+	}
 
-		rootStyle := fmt.Sprintf(`
+	rootStyle := fmt.Sprintf(`
     :root {
       %s
     }
     `, theme)
 
-		if pf.theme.link != "" {
-			rootStyle += fmt.Sprintf(`
+	if link != "" {
+		rootStyle += fmt.Sprintf(`
       a {
         color: %s !important;
-      }`, pf.theme.link)
-		}
-		style := fmt.Sprintf(`<style>%s</style`, rootStyle)
-		header = strings.ReplaceAll(header, themeSentinel, style)
-	} else {
-		header = strings.ReplaceAll(header, backgroundSentinel, "")
+      }`, link)
 	}
+	return fmt.Sprintf(`<style>%s</style>`, rootStyle)
+}
+
+// the page's meta tags: its description, open graph preview, and any other metadata (e.g. vcs discovery tags)
+func pageMetadata(pf PageFragment) string {
 	var htmlMeta string
+	if highlightEnabled() {
+		htmlMeta += fmt.Sprintf(`<link rel="stylesheet" href="/%s">%s`, HIGHLIGHT_STYLESHEET, "\n")
+	}
+	if pf.route != "" && host != "" {
+		htmlMeta += fmt.Sprintf(`<link rel="canonical" href="%s">%s`, html.EscapeString(util.ConstructURL(canonicalUrl, routeLink(pf.route))), "\n")
+	}
+	if pf.brief != "" {
+		htmlMeta += fmt.Sprintf(`<meta name="description" content="%s">%s`, html.EscapeString(pf.brief), "\n")
+	}
+	// generate opengraph metadata and image
+	if generateOG && pf.title != "" {
+		htmlMeta += generatePreview(pf)
+	}
+	if crumbs := breadcrumbs(pf); len(crumbs) > 0 && host != "" {
+		htmlMeta += breadcrumbStructuredData(crumbs) + "\n"
+	}
+	// add other metadata, such as the experimental vcs discovery meta tags for repos
+	if len(pf.metadata) > 0 {
+		htmlMeta += strings.Join(pf.metadata, "\n")
+	}
+	return htmlMeta
+}
+
+func htmlPreamble(pf PageFragment) string {
+	var mainNav string
+	if link, text := backLink(pf); link != "" {
+		mainNav += fmt.Sprintf(`<li><a href="%s">Back to %s</a></li>`, html.EscapeString(link), html.EscapeString(text))
+	} else {
+		mainNav = "<li></li> "
+	}
+	crumbs := breadcrumbs(pf)
+	if len(crumbs) > 0 {
+		// the breadcrumbs replace the back link
+		mainNav = "<li></li> "
+	}
+	mainNav += renderNavigation(navElements, pf)
+	header, err := readTemplate("header.html", DEFAULT_HEADER)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	// add background image & theme to an article if they have been set
+	const backgroundSentinel = "<!-- background -->"
+	const themeSentinel = "<!-- theme -->"
+	header = strings.ReplaceAll(header, backgroundSentinel, backgroundStyle(pf))
+	if style := themeStyle(pf); style != "" {
+		header = strings.ReplaceAll(header, themeSentinel, style)
+	}
 	// augment html meta tags and titles with article metadata.
 	// grab unaugmented <title>
 	match := titlePattern.FindStringSubmatch(header)
 	if len(match) >= 3 {
+		// pages without a title of their own keep the site's title, with their metadata following it
+		title := match[1]
 		if pf.title != "" {
-			htmlMeta += fmt.Sprintf(`<title>%s — %s</title>%s`, pf.title, match[2], "\n")
+			title = fmt.Sprintf(`<title>%s — %s</title>`, html.EscapeString(pf.title), match[2])
 		}
-		if pf.brief != "" {
-			htmlMeta += fmt.Sprintf(`<meta name="description" content="%s">%s`, pf.brief, "\n")
+		if htmlMeta := pageMetadata(pf); htmlMeta != "" || title != match[1] {
+			header = strings.Replace(header, match[1], title+"\n"+htmlMeta, -1)
 		}
+	}
+	return fmt.Sprintf(`%s
+  <nav>
+    <ul class="main-navigation">
+    %s
+    </ul>
+  </nav>%s`, header, mainNav, renderBreadcrumbs(crumbs))
+}
 
-		// generate opengraph metadata and image
-		if generateOG && pf.title != "" {
-			_, articleName := extractFilenames(pf.location)
-			// if rewrittenDest != "" {
-			//   articleName = rewrittenDest
-			// }
-			imageName := fmt.Sprintf("%s.png", strings.ReplaceAll(strings.ToLower(articleName), " ", "-"))
-			imagePath := filepath.Join(OUTPATH, "og", imageName)
-			canonicalPath := fmt.Sprintf("%s/og/%s", canonicalUrl, imageName)
-			err = os.MkdirAll(filepath.Dir(imagePath), 0777)
-			util.Check(err)
+// name the preview image after the page's route, e.g. /articles/trustnet -> articles-trustnet.png
+func previewImageName(route string) string {
+	name := strings.Trim(filepath.ToSlash(route), "/")
+	if name == "" {
+		name = "index"
+	}
+	name = strings.ReplaceAll(strings.ReplaceAll(name, "/", "-"), " ", "-")
+	return fmt.Sprintf("%s.png", strings.ToLower(name))
+}
+
+// returns the dimensions of the image at path, or zeroes if it can't be decoded
+func imageDimensions(path string) (int, int) {
+	file, err := os.Open(path)
+	if err != nil {
+		return 0, 0
+	}
+	defer file.Close()
+	cfg, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return 0, 0
+	}
+	return cfg.Width, cfg.Height
+}
 
-			settings := og.GetDefaultSettings()
-			htmlMeta += og.GenerateMetadata(pf.title, pf.brief, canonicalPath, settings)
-			// og.GenerateImage(pf.title, pf.brief, imagePath, settings)
+// returns the absolute url & dimensions of an image that's already part of the site, e.g. a header image
+func siteImage(webpath string) (string, int, int) {
+	if strings.HasPrefix(webpath, "https://") || strings.HasPrefix(webpath, "http://") {
+		return webpath, 0, 0
+	}
+	width, height := imageDimensions(filepath.Join(OUTPATH, webpath))
+	return util.ConstructURL(canonicalUrl, filepath.Join("/", webpath)), width, height
+}
+
+// returns the meta tags for the page's link preview. in order of preference, the preview image is:
+// the image set with the preview image command, the header image, the background image, or a generated image
+// (rendered unless the title & brief are unchanged since it was last rendered)
+func generatePreview(pf PageFragment) string {
+	settings := previewSettings()
+	imageName := previewImageName(pf.route)
+	imagePath := filepath.Join(OUTPATH, "og", imageName)
+	pageURL := util.ConstructURL(canonicalUrl, routeLink(pf.route))
+	err := os.MkdirAll(filepath.Dir(imagePath), 0777)
+	util.Check(err)
+
+	if pf.preview != "" {
+		if _, err := os.Stat(pf.preview); err != nil {
+			fmt.Println("plain: could not use preview image", err)
+		} else {
+			imageName = strings.TrimSuffix(imageName, ".png") + filepath.Ext(pf.preview)
+			err = copyFile(pf.preview, filepath.Join(OUTPATH, "og", imageName))
+			util.Check(err)
+			// the copied image may have overwritten a generated one; make sure it's regenerated if the preview is unset
+			delete(ogmap, previewImageName(pf.route))
+			imageURL, width, height := siteImage(fmt.Sprintf("/og/%s", imageName))
+			return og.GenerateMetadata(pf.title, pf.brief, pageURL, imageURL, width, height)
 		}
 	}
-	// add other metadata, such as the experimental vcs discovery meta tags for repos
-	if len(pf.metadata) > 0 {
-		htmlMeta += strings.Join(pf.metadata, "\n")
+	if pf.headerImage != "" || pf.background != "" {
+		webpath := pf.headerImage
+		if webpath == "" {
+			webpath = pf.background
+		}
+		imageURL, width, height := siteImage(webpath)
+		return og.GenerateMetadata(pf.title, pf.brief, pageURL, imageURL, width, height)
 	}
 
-	if htmlMeta != "" {
-		header = strings.Replace(header, match[1], htmlMeta, -1)
+	fingerprint := og.Fingerprint(pf.title, pf.brief, settings)
+	_, err = os.Stat(imagePath)
+	if err == nil && ogmap[imageName] == fingerprint {
+		echo("preview unchanged, skipping", imagePath)
+	} else if err = og.GenerateImage(pf.title, pf.brief, imagePath, settings); err != nil {
+		fmt.Println("plain: could not generate preview", err)
+	} else {
+		echo("wrote preview", imagePath)
+		ogmap[imageName] = fingerprint
 	}
-	return fmt.Sprintf(`%s
-  <nav>
-    <ul class="main-navigation">
-    %s
-    </ul>
-  </nav>`, header, mainNav)
+	imageURL := util.ConstructURL(canonicalUrl, fmt.Sprintf("/og/%s", imageName))
+	return og.GenerateMetadata(pf.title, pf.brief, pageURL, imageURL, settings.Width, settings.Height)
 }
 
 func htmlEpilogue() string {
@@ -431,18 +752,24 @@ var OUTPATH = filepath.Join(".", "web")
 
 func extractPageFragments(webpath string, underParent bool, elements []Element) []string {
 	// TODO: do 2 pass to identify alternate write paths for PATH_MD / COPY_DIR, as set by LINK tag?
-	var html []string
-	html = append(html, "<dl class='listicle'>")
+	var fragments []string
+	fragments = append(fragments, "<dl class='listicle h-feed'>")
 	for _, el := range elements {
 		pf := PageFragment{webpath: webpath, underParent: underParent}
 		pf.metadata = make([]string, 0)
 		var rewrittenDest string
+		var route string // the route of the page written for the entry (md, or a repository's readme)
+		var redirects, aliases []string // routes redirecting to the entry, written once its final link is known
+		var renamed string              // the name set by rn, which pages & copied directories are written to directly
+		var copiedDir bool
 		branchName := "master" // used for GIT_REPO
 		// var background string
 		for _, p := range el.pairs {
 			switch symbol(p.code) {
 			case GIT_BRANCH:
 				branchName = p.content
+			case RENAME:
+				renamed = p.content
 			case PATH_WWWROOT:
 				rewrittenDest = p.content
 			case TITLE:
@@ -457,6 +784,14 @@ func extractPageFragments(webpath string, underParent bool, elements []Element)
 				pf.theme.foreground = p.content
 			case LINK_COLOR:
 				pf.theme.link = p.content
+			case PREVIEW_IMAGE:
+				pf.preview = p.content
+			case LAYOUT:
+				pf.layout = p.content
+			case MARKDOWN_EXTENSIONS:
+				pf.markdown = p.content
+			case TABLE_OF_CONTENTS:
+				pf.toc = p.content
 			case LINK:
 				if pf.link != "" {
 					echo(fmt.Sprintf("err: already set link on page fragment? %v\n", el.pairs))
@@ -480,9 +815,9 @@ func extractPageFragments(webpath string, underParent bool, elements []Element)
 				clonePath := fmt.Sprintf(`http://git.%s/%s.git`, host, repoName)
 				// support VCS Autodiscovery (https://git.sr.ht/~ancarda/vcs-autodiscovery-rfc)
 				pf.metadata = append(pf.metadata, `<meta name="vcs" content="git" />`)
-				pf.metadata = append(pf.metadata, fmt.Sprintf(`<meta name="vcs:default-branch" content="%s" />`, branchName))
-				pf.metadata = append(pf.metadata, fmt.Sprintf(`<meta name="vcs:clone" content="%s" />`, clonePath))
-				pf.metadata = append(pf.metadata, fmt.Sprintf(`<meta name="forge:summary" content="https://%s/%s">`, canonicalUrl, repoName))
+				pf.metadata = append(pf.metadata, fmt.Sprintf(`<meta name="vcs:default-branch" content="%s" />`, html.EscapeString(branchName)))
+				pf.metadata = append(pf.metadata, fmt.Sprintf(`<meta name="vcs:clone" content="%s" />`, html.EscapeString(clonePath)))
+				pf.metadata = append(pf.metadata, fmt.Sprintf(`<meta name="forge:summary" content="%s">`, html.EscapeString(util.ConstructURL(canonicalUrl, repoName))))
 
 				// check for readme variants to render
 				readmeVariations := []string{"README.md", "readme.md", "README"}
@@ -502,27 +837,22 @@ func extractPageFragments(webpath string, underParent bool, elements []Element)
 						pf.location = readmePath
 						// yank'd out of CopyMarkdownFile so we can inject the git clone instruction
 						filename, _ := extractFilenames(pf.location)
-						md, err := ReadMarkdownFile(filename)
+						md, err := ReadMarkdownFile(filename, pf.markdown)
 						util.Check(err)
-						lines := strings.Split(md.contents, "\n")
-						injected := fmt.Sprintf(`<div id="clone"><span>%s</span><span>git clone %s</span></div>`, stats, clonePath)
-						if strings.Contains(lines[0], "<h1>") {
-							newLines := []string{lines[0], injected}
-							newLines = append(newLines, lines[1:]...)
-							md.contents = strings.Join(newLines, "\n")
-						} else {
-							newLines := []string{injected}
-							newLines = append(newLines, lines...)
-							md.contents = strings.Join(newLines, "\n")
+						injected := fmt.Sprintf(`<div id="clone"><span>%s</span><span>git clone %s</span></div>`, html.EscapeString(stats), html.EscapeString(clonePath))
+						md.contents = injectAfterTitle(md.contents, injected)
+						dest := rewrittenDest
+						if renamed != "" {
+							dest = renamed
 						}
-						err = WriteMarkdownAsHTML(pf, rewrittenDest, md)
+						err = WriteMarkdownAsHTML(pf, dest, md)
 						util.Check(err)
 
-						_, articleName := extractFilenames(p.content)
-						if rewrittenDest != "" {
-							articleName = rewrittenDest
+						route = filepath.Join("/", dest)
+						if pf.underParent {
+							route = filepath.Join("/", pf.webpath, dest)
 						}
-						pf.link = filepath.Join("/", articleName)
+						pf.link = routeLink(route)
 						break
 					}
 				}
@@ -533,13 +863,19 @@ func extractPageFragments(webpath string, underParent bool, elements []Element)
 					echo(fmt.Sprintf("tried to copy '%s'; stopped the operation as it seems unlikely to be correct :)", p.content))
 					continue
 				}
-				err := CopyDirectory(p.content, OUTPATH, rewrittenDest)
+				dest := rewrittenDest
+				if renamed != "" {
+					// syncing into the final directory, rather than renaming a fresh copy over it, keeps the sync cheap
+					dest = renamed
+				}
+				err := CopyDirectory(p.content, OUTPATH, dest)
 				util.Check(err)
 				base := filepath.Base(p.content)
-				if rewrittenDest != "" {
-					base = rewrittenDest
+				if dest != "" {
+					base = dest
 				}
 				pf.link = filepath.Join("/", base)
+				copiedDir = true
 			case VERBATIM:
 				// TODO (2024-04-27): MAKE THIS WORK
 				// INCLUDING COMPOSING WELL WITH THE REWRITE-Y COMMANDS LIKE 
@@ -553,7 +889,8 @@ func extractPageFragments(webpath string, underParent bool, elements []Element)
 				}
 				base := filepath.Base(p.content)
 				dstpath := filepath.Join(OUTPATH, base)
-				copyFile(p.content, dstpath)
+				err := copyFile(p.content, dstpath)
+				util.Check(err)
 				if rewrittenDest != "" {
 					base = rewrittenDest
 				}
@@ -561,83 +898,60 @@ func extractPageFragments(webpath string, underParent bool, elements []Element)
 			case PATH_MD:
 				// source a markdown file from one place and output a corresponding html site in plain's webroot
 				pf.location = p.content
-				err := CopyMarkdownFile(pf, rewrittenDest)
+				dest := rewrittenDest
+				if renamed != "" {
+					// written under its final route, which its canonical link, preview & feed item all follow from
+					dest = renamed
+				}
+				err := CopyMarkdownFile(pf, dest)
 				if err != nil {
 					continue
 				}
 				_, articleName := extractFilenames(p.content)
-				if rewrittenDest != "" {
-					articleName = rewrittenDest
+				if dest != "" {
+					articleName = dest
 				}
-				pf.link = filepath.Join("/", articleName)
+				route = filepath.Join("/", articleName)
 				if pf.underParent {
-					pf.link = filepath.Join("/", pf.webpath, articleName)
+					route = filepath.Join("/", pf.webpath, articleName)
 				}
+				pf.link = routeLink(route)
 			case REDIRECT:
-				err := DumpRedirectFile(p.content)
-				util.Check(err)
+				redirects = append(redirects, p.content)
 			case ALIAS:
-				err := DumpAliasFile(p.content, pf.link)
-				util.Check(err)
+				aliases = append(aliases, p.content)
 			case RENAME:
+				if copiedDir || route != "" {
+					// already written under its new name
+					continue
+				}
 				dirname := filepath.Dir(pf.link)
 				err := RenameFile(pf.link, filepath.Join(dirname, p.content))
-				pf.link = filepath.Join("/", p.content)
+				pf.link = filepath.Join(dirname, p.content)
 				util.Check(err)
 			}
 		}
-		html = append(html, pf.assemble())
-	}
-	html = append(html, "</dl>")
-	return html
-}
-
-var ignored = []string{".git", "node_modules"}
-
-func containsIgnored(s string) bool {
-	for _, ignoredString := range ignored {
-		if ignoredString == s {
-			return true
-		}
-	}
-	return false
-}
-
-// Copy the contents of a directory to the webroot, preserving the directory's basename.
-// Traverses readDir, copying files to the writeDir (of the form: filepath.Join(OUTPATH, filepath.Base(readDir)))
-func CopyDirectory(readDir, writeDir, rewrittenDest string) error {
-	base := filepath.Base(readDir)
-	if rewrittenDest != "" {
-		base = rewrittenDest
-	}
-	dst := filepath.Join(writeDir, base)
-	files, err := os.ReadDir(readDir)
-	if err != nil {
-		return err
-	}
-	err = os.MkdirAll(dst, 0777)
-	if err != nil {
-		return err
-	}
-	// perform os.Create / os.Mkdir at dst (and not at writeDir)
-	for _, f := range files {
-		if f.IsDir() && !containsIgnored(f.Name()) {
-			CopyDirectory(filepath.Join(readDir, f.Name()), dst, "")
-		} else {
-			srcfile, err := os.Open(filepath.Join(readDir, f.Name()))
-			if err != nil {
-				return err
+		// the entry's commands may change its link in any order (e.g. mv before rn), so redirects are written last
+		for _, from := range redirects {
+			if pf.link == "" {
+				fmt.Printf("plain: can't redirect %s, as its entry has no link\n", from)
+				continue
 			}
-			dstfile, err := os.Create(filepath.Join(dst, f.Name()))
-			if err != nil {
-				return err
+			err := DumpRedirectFile(from, pf.link)
+			util.Check(err)
+		}
+		for _, alias := range aliases {
+			if pf.link == "" {
+				fmt.Printf("plain: can't alias %s, as its entry has no link\n", alias)
+				continue
 			}
-			io.Copy(dstfile, srcfile)
-			srcfile.Close()
-			dstfile.Close()
+			err := DumpAliasFile(alias, pf.link)
+			util.Check(err)
 		}
+		fragments = append(fragments, pf.assemble())
 	}
-	return nil
+	fragments = append(fragments, "</dl>")
+	return fragments
 }
 
 // processes the location and extracts the article name from the location, with the file md suffix & initial path removed
@@ -645,16 +959,10 @@ func extractFilenames(location string) (string, string) {
 	return strings.TrimSpace(location), strings.TrimSuffix(filepath.Base(location), ".md")
 }
 
-func (md *mdFile) rewriteImageUrls(mediadir string) {
-	for _, image := range md.images {
-		md.contents = strings.ReplaceAll(md.contents, image, filepath.Join("/", mediadir, filepath.Base(image)))
-	}
-}
-
 // copies markdown file at location, returns strings.TrimSuffix(filepath.Base(location), ".md")
 func CopyMarkdownFile(pf PageFragment, rewrittenDest string) error {
 	filename, _ := extractFilenames(pf.location)
-	md, err := ReadMarkdownFile(filename)
+	md, err := ReadMarkdownFile(filename, pf.markdown)
 	if err != nil {
 		return err
 	}
@@ -665,8 +973,19 @@ func CopyMarkdownFile(pf PageFragment, rewrittenDest string) error {
 //go:embed default/redirect-template.html
 var REDIRECT_TEMPLATE string
 
-//go:embed default/alias-template.html
-var ALIAS_TEMPLATE string
+// marks the pages written from REDIRECT_TEMPLATE, which may be overwritten by later builds
+const REDIRECT_MARKER = "<!-- plain: redirect -->"
+
+// the refresh tag of the redirect & alias pages written by earlier versions of plain, which carry no marker
+const LEGACY_REDIRECT_REFRESH = `<meta http-equiv="refresh" content="0 url=site/home.html" />`
+
+// whether contents is a redirect page written by plain, by this version or an earlier one
+func isRedirectPage(contents string) bool {
+	if strings.Contains(contents, REDIRECT_MARKER) {
+		return true
+	}
+	return strings.Contains(contents, LEGACY_REDIRECT_REFRESH) && strings.Contains(contents, "<p>Redirecting</p>")
+}
 
 // The mv command to redirects from older routes to the declared one
 // examples:
@@ -676,8 +995,9 @@ var ALIAS_TEMPLATE string
 // md wiki/life/support.md
 // mv /support.html   dumps a "support.html" in the web dir
 // mv /about          creates a folder "about" & dumps the redirect in its index.html
-
-func DumpRedirectFile(webpath string) error {
+//
+// the redirect points at destination, the final link of the item (after ww, un & rn have been applied)
+func DumpRedirectFile(webpath, destination string) error {
 	var outfile string
 	var dirStructure string
 	// redirecting a html-suffixed file, e.g. /web/articles/cool-article.html
@@ -697,67 +1017,55 @@ func DumpRedirectFile(webpath string) error {
 			return err
 		}
 	}
-	// but first: make sure we're not clobbering something that's already there
-	_, err := os.Stat(outfile)
-	// ok: we're not clobbering anything, time to dump stuff
-	if errors.Is(err, os.ErrNotExist) {
-		err = os.WriteFile(outfile, []byte(REDIRECT_TEMPLATE), 0666)
+	return writeRedirect(outfile, webpath, destination)
+}
+
+// writes a page to outfile that redirects visitors from the route source to destination, unless that would clobber
+// something that's already there (other than a redirect from a previous build)
+func writeRedirect(outfile, source, destination string) error {
+	existing, err := os.ReadFile(outfile)
+	if err == nil && !isRedirectPage(string(existing)) {
+		fmt.Printf("plain: not writing redirect %s, as it would overwrite a page\n", outfile)
+		return nil
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
 		return err
-	} else if err != nil {
+	}
+	// search engines expect the canonical link to be absolute
+	canonical := destination
+	if u, err := url.Parse(destination); err == nil && !u.IsAbs() && canonicalUrl != "" {
+		canonical = util.ConstructURL(canonicalUrl, destination)
+	}
+	redirect := strings.NewReplacer(
+		"$DESTINATION$", html.EscapeString(destination),
+		"$CANONICAL$", html.EscapeString(canonical),
+	).Replace(REDIRECT_TEMPLATE)
+	err = os.WriteFile(outfile, []byte(redirect), 0666)
+	if err != nil {
 		return err
 	}
+	redirectRules = append(redirectRules, redirectRule{source: source, destination: destination})
 	return nil
 }
 
+// moves the file at oldpath to newpath, replacing a file (but never a directory) at newpath
 func RenameFile(oldpath, newpath string) error {
 	oldpath = filepath.Join(OUTPATH, oldpath)
 	newpath = filepath.Join(OUTPATH, newpath)
-	info, err := os.Stat(newpath)
-	if errors.Is(err, os.ErrNotExist) {
-	// the destination does not exist, great! we can proceed. if it's some other kind of error, we should just throw it
-	}
-	if info != nil && info.IsDir() {
-		err = os.RemoveAll(newpath)
-		if err != nil {
-			return err
-		}
-	}
-	// if we get a fileinfo back we know that the directory exists and we basically want to overwrite it -> let's do it
-	err = os.Rename(oldpath, newpath)
-	if err != nil {
-		return err
-	}
-	// make sure the old dir is removed
-	err = os.Remove(oldpath)
-	if errors.Is(err, os.ErrNotExist) {
-		return nil
+	if info, err := os.Stat(newpath); err == nil && info.IsDir() {
+		return fmt.Errorf("rename %s: %s is a directory, which won't be replaced", oldpath, newpath)
 	}
-	return err
+	return os.Rename(oldpath, newpath)
 }
 
 func DumpAliasFile(aliasPath, webpath string) error {
-	var outfile string
-	var dst string
-
-	dst = webpath
-	// we'll create outfile as it's the alias that will be visited intially (which will redirect to `dst`)
-	outfile = filepath.Join(OUTPATH, aliasPath, "index.html")
+	// we'll create outfile as it's the alias that will be visited intially (which will redirect to webpath)
+	outfile := filepath.Join(OUTPATH, aliasPath, "index.html")
 	// make sure we have the appropriate folder structure
 	err := os.MkdirAll(filepath.Join(OUTPATH, aliasPath), 0777)
 	if err != nil {
 		return err
 	}
-	// but first: make sure we're not clobbering something that's already there
-	_, err = os.Stat(outfile)
-	// ok: we're not clobbering anything, time to dump stuff
-	if errors.Is(err, os.ErrNotExist) {
-		aliasInstance := strings.ReplaceAll(ALIAS_TEMPLATE, "$SENTINEL$", dst)
-		err = os.WriteFile(outfile, []byte(aliasInstance), 0666)
-		return err
-	} else if err != nil {
-		return err
-	}
-	return nil
+	return writeRedirect(outfile, aliasPath, webpath)
 }
 
 // the "markdown" we're writing has actually already been parsed as html, so what we're writing is really just html. but
@@ -768,10 +1076,11 @@ func WriteMarkdownAsHTML(pf PageFragment, rewrittenDest string, md mdFile) error
 	if rewrittenDest != "" {
 		articleName = rewrittenDest
 	}
-	outfile := filepath.Join(OUTPATH, articleName, "index.html")
+	pf.route = filepath.Join("/", articleName)
 	if pf.underParent {
-		outfile = filepath.Join(OUTPATH, pf.webpath, articleName, "index.html")
+		pf.route = filepath.Join("/", pf.webpath, articleName)
 	}
+	outfile := filepath.Join(OUTPATH, routeFile(pf.route))
 
 	echo("try to open", filename)
 	err := os.MkdirAll(filepath.Dir(outfile), 0777)
@@ -779,11 +1088,30 @@ func WriteMarkdownAsHTML(pf PageFragment, rewrittenDest string, md mdFile) error
 		return err
 	}
 
-	if len(md.images) > 0 {
-		err = persistImages(pf.location, md)
-		if err != nil {
-			return err
-		}
+	md.contents = withTableOfContents(md.contents, pf.toc, md.headings)
+
+	// pages without a tt or bb of their own are described by their markdown
+	if pf.title == "" {
+		pf.title = md.title
+	}
+	if pf.brief == "" {
+		pf.brief = md.summary
+	}
+	pf.article = true
+	if info, err := os.Stat(filename); err == nil {
+		pf.modified = info.ModTime()
+		pf.published = info.ModTime()
+	}
+	// prefer the date the article was first published in a feed, if it has been
+	if item, exists := rssmap[pf.route]; exists {
+		pf.published = time.Unix(item.Pubdate, 0)
+	}
+	// the feed's date comes from a different clock than the file's, and may well be the later of the two
+	if pf.modified.Before(pf.published) {
+		pf.modified = pf.published
+	}
+	if pf.title != "" {
+		pf.metadata = append(pf.metadata, articleStructuredData(pf))
 	}
 
 	echo("writing file contents to", outfile)
@@ -792,35 +1120,22 @@ func WriteMarkdownAsHTML(pf PageFragment, rewrittenDest string, md mdFile) error
 }
 
 
-func persistImages (baseLocation string, md mdFile) error {
-	echo("persisting images")
-	mediabase := "media"
-	mediadir := filepath.Join(OUTPATH, mediabase)
-	// make sure the <OUTPATH>/media dir exists
-	err := os.MkdirAll(mediadir, 0777)
+// extensions lists the markdown extensions to enable (or disable) for this file, on top of the site-wide ones
+func ReadMarkdownFile(filename, extensions string) (mdFile, error) {
+	filename = strings.TrimSpace(filename)
+	b, err := os.ReadFile(filename)
 	if err != nil {
-		return err
-	}
-	// copy all images from their source to mediadir
-	for _, img := range md.images {
-		base := strings.Split(filepath.ToSlash(baseLocation), "/")[0]
-		src := filepath.Join(base, img)
-		dst := filepath.Join(mediadir, filepath.Base(img))
-		echo(fmt.Sprintf("copying %s to %s\n", src, dst))
-		copyFile(src, dst)
+		return mdFile{}, err
 	}
-	md.rewriteImageUrls(mediabase)
-	return nil
-}
-
-func ReadMarkdownFile(filename string) (mdFile, error) {
-	b, err := os.ReadFile(strings.TrimSpace(filename))
+	b = transformWikilinks(b)
+	opts := markdownSettings(extensions)
+	doc := parseMarkdown(b, opts)
+	err = persistMedia(filename, doc)
 	if err != nil {
 		return mdFile{}, err
 	}
-	paths := extractImagePaths(b)
-	b = transformWikilinks(b)
-	return mdFile{contents: string(markdown.ToHTML(b, nil, nil)), images: paths}, nil
+	contents, outline := renderDocument(doc, opts)
+	return mdFile{contents: string(contents), outline: outline}, nil
 }
 
 func produceRepoStatistics (repoSrcPath, dst string) string {
@@ -949,7 +1264,13 @@ func setupBareRepo(repoSrcPath, dst, defaultBranch string) {
 }
 
 func wrap(pf PageFragment, html string) string {
-	return fmt.Sprintf(`%s %s %s`, htmlPreamble(pf), htmlContent(html), htmlEpilogue())
+	if pf.layout != "" {
+		return renderLayout(namedLayout(pf.layout), pf, html)
+	}
+	if layout := configString("layout", ""); layout != "" {
+		return renderLayout(layout, pf, html)
+	}
+	return fmt.Sprintf(`%s %s %s`, htmlPreamble(pf), htmlContent(pf, html), htmlEpilogue())
 }
 
 func readListicle(filename string) []Element {
@@ -977,13 +1298,14 @@ func readListicle(filename string) []Element {
 }
 
 var navElements []navigation
+var routeTitles = make(map[string]string) // the routes declared in the index (ww), and their titles
 
 func headerImageTemplate (imgPath string) string {
 	return fmt.Sprintf(`
 	<div>
 	<img class="header-image" src="%s">
 	</div>
-	`, imgPath)
+	`, html.EscapeString(imgPath))
 }
 
 func processRootListicle(elements []Element) {
@@ -996,8 +1318,11 @@ func processRootListicle(elements []Element) {
 		var navEl navigation
 		var listicleName string
 		var nestUnderParent bool
+		var title string
 		for _, p := range el.pairs {
 			switch symbol(p.code) {
+			case TITLE:
+				title = util.SanitizeMarkdown(p.content)
 			case UNDER_CATEGORY:
 				nestUnderParent = true
 			case PATH_SSG:
@@ -1009,6 +1334,15 @@ func processRootListicle(elements []Element) {
 				feeds = append(feeds, feedDescription{name: listicleName, nested: nestUnderParent, description: p.content})
 			case NAVIGATION_TITLE:
 				navEl.text = p.content
+			case NAVIGATION_GROUP:
+				navEl.group = p.content
+			case NAVIGATION_ORDER:
+				order, err := strconv.Atoi(p.content)
+				if err != nil {
+					fmt.Printf("plain: navigation order (%s) must be a whole number, ignoring it\n", p.content)
+					continue
+				}
+				navEl.order = order
 			case PATH_WWWROOT:
 				navEl.link = p.content
 			default:
@@ -1016,17 +1350,44 @@ func processRootListicle(elements []Element) {
 			}
 		}
 		navElements = append(navElements, navEl)
+		// the first title declared for a route names it, e.g. in breadcrumbs
+		if navEl.link != "" && routeTitles[navEl.link] == "" {
+			routeTitles[navEl.link] = title
+		}
 	}
+	navElements = buildNavigation(navElements)
 
 	// output listicle enumerating rss feeds
 	if len(feeds) > 0 {
 		feeds = append(feeds, feedDescription{name: "all", description: fmt.Sprintf("all of %s", util.TrimUrl(canonicalUrl))})
 		OutputFeedsListicle(feeds)
 	}
+	siteFeeds = feeds
+
+	// create rss files for all feeds. this happens before any page is written so that articles can be stamped with
+	// the publish date of their feed item
+	if len(feeds) > 0 {
+		if canonicalUrl == "" {
+			fmt.Println("plain: specified rss generation, but the canonical url flag (--url) is not set")
+			echo("not writing rss feeds")
+		} else {
+			GenerateFeeds(feeds, canonicalUrl)
+		}
+	}
 
 	// second pass: generate the content && html
 	for i, el := range elements {
 		var page Page
+		var redirects []string // routes redirecting to the page, written once all of its commands are processed
+		// the markdown extensions & table of contents apply to the group's md files, wherever they are declared
+		for _, p := range el.pairs {
+			switch symbol(p.code) {
+			case MARKDOWN_EXTENSIONS:
+				page.pf.markdown = p.content
+			case TABLE_OF_CONTENTS:
+				page.pf.toc = p.content
+			}
+		}
 		for _, p := range el.pairs {
 			switch symbol(p.code) {
 			case UNDER_CATEGORY:
@@ -1038,12 +1399,21 @@ func processRootListicle(elements []Element) {
 				page.headerContent = append(page.headerContent, markup(p.content))
 				page.pf.title = util.SanitizeMarkdown(p.content)
 			case HEADER_IMAGE:
-				dstPath := filepath.Join("/media", filepath.Base(p.content))
+				if _, err := os.Stat(p.content); err != nil {
+					fmt.Printf("plain: header image %s not found, skipping it\n", p.content)
+					continue
+				}
+				dstPath, err := persistMediaFile(p.content)
+				util.Check(err)
 				page.headerContent = append(page.headerContent, headerImageTemplate(dstPath))
-				persistImages(p.content, mdFile{images: []string{dstPath}})
+				page.pf.headerImage = dstPath
 			case BRIEF:
 				page.headerContent = append(page.headerContent, markup(p.content))
 				page.pf.brief = util.SanitizeMarkdown(p.content)
+			case PREVIEW_IMAGE:
+				page.pf.preview = p.content
+			case LAYOUT:
+				page.pf.layout = p.content
 			case COPY_DIR:
 				echo("copying directory at", p.content)
 				if p.content == "/" || p.content == "~" {
@@ -1053,13 +1423,19 @@ func processRootListicle(elements []Element) {
 				err := CopyDirectory(p.content, OUTPATH, "")
 				util.Check(err)
 			case PATH_MD: // change to work the same way as for regular listicles
-				md, err := ReadMarkdownFile(p.content)
+				md, err := ReadMarkdownFile(p.content, page.pf.markdown)
 				if err != nil {
 					echo(fmt.Errorf("%w", err))
 					continue
 				}
-				if len(md.images) > 0 {
-					persistImages(p.content, md)
+				md.contents = withTableOfContents(md.contents, page.pf.toc, md.headings)
+				// pages without a tt or bb of their own are described by their markdown; a tt or bb declared after
+				// the md command still takes precedence
+				if page.pf.title == "" {
+					page.pf.title = md.title
+				}
+				if page.pf.brief == "" {
+					page.pf.brief = md.summary
 				}
 				page.html = append(page.html, md.contents)
 			case PATH_SSG:
@@ -1071,8 +1447,7 @@ func processRootListicle(elements []Element) {
 				}
 				page.html = append(page.html, extractPageFragments(page.pf.webpath, page.parentDir, resource)...)
 			case REDIRECT:
-				err := DumpRedirectFile(p.content)
-				util.Check(err)
+				redirects = append(redirects, p.content)
 			case SKIP:
 				fallthrough
 			default:
@@ -1080,6 +1455,15 @@ func processRootListicle(elements []Element) {
 			}
 		}
 
+		for _, from := range redirects {
+			if page.pf.webpath == "" {
+				fmt.Printf("plain: can't redirect %s, as it's not declared alongside a route (ww)\n", from)
+				continue
+			}
+			err := DumpRedirectFile(from, routeLink(page.pf.webpath))
+			util.Check(err)
+		}
+
 		// we're inserting another ssg page into an already registered page, add some spacing
 		// to visually separate them
 		if pagePrev, ok := pages[page.pf.webpath]; ok {
@@ -1088,22 +1472,15 @@ func processRootListicle(elements []Element) {
 			page.html = append(pagePrev.html, page.html...)
 			// don't overwrite the previous title
 			page.pf.title = pagePrev.pf.title
+			if page.pf.layout == "" {
+				page.pf.layout = pagePrev.pf.layout
+			}
 		} else {
 			page.html = append(page.produceHeader(), page.html...)
 		}
 		pages[page.pf.webpath] = page
 	}
 
-	// create rss files for all feeds
-	if len(feeds) > 0 {
-		if canonicalUrl == "" {
-			fmt.Println("plain: specified rss generation, but the canonical url flag (--url) is not set")
-			echo("not writing rss feeds")
-		} else {
-			GenerateFeeds(feeds, canonicalUrl)
-		}
-	}
-
 	// write all html to files
 	persistToFS(pages)
 }
@@ -1135,10 +1512,10 @@ func persistToFS(pages map[string]Page) {
 		if len(page.html) == 0 {
 			continue
 		}
-		dirname := filepath.Join(OUTPATH, strings.TrimPrefix(route, "/"))
-		filename := filepath.Join(dirname, "index.html")
-		err := os.MkdirAll(dirname, 0777)
+		filename := filepath.Join(OUTPATH, routeFile(route))
+		err := os.MkdirAll(filepath.Dir(filename), 0777)
 		util.Check(err)
+		page.pf.route = route
 		page.pf.webpath = createHistoryLink(route)
 		html := wrap(page.pf, strings.Join(page.html, ""))
 		err = os.WriteFile(filename, []byte(html), 0666)
@@ -1147,15 +1524,19 @@ func persistToFS(pages map[string]Page) {
 }
 
 func createHistoryLink(k string) string {
+	// don't link back to anything (we're at the root, or home page)
+	if strings.TrimSpace(k) == "/" {
+		return ""
+	}
+	// with breadcrumbs, link back to the closest route declared in the index, defaulting to the root
+	if configBool("breadcrumbs", false) {
+		return parentRoute(strings.TrimSpace(k))
+	}
 	webpathParts := strings.Split(k, "/")
 	webpath := "/" // default to linking back to the root
 	if len(webpathParts) > 2 {
 		webpath = strings.TrimSpace(strings.Join(webpathParts[:len(webpathParts)-1], "/"))
 	}
-	// don't link back to anything (we're at the root, or home page)
-	if strings.TrimSpace(k) == "/" {
-		webpath = ""
-	}
 	return webpath
 }
 
@@ -1168,6 +1549,12 @@ var DEFAULT_HEADER string
 //go:embed default/default-footer.html
 var DEFAULT_FOOTER string
 
+//go:embed default/default-layout.html
+var DEFAULT_LAYOUT string
+
+//go:embed default/default-config
+var DEFAULT_CONFIG string
+
 //go:embed default/default-style.css
 var DEFAULT_CSS string
 
@@ -1198,15 +1585,22 @@ func createIfNotExist(name, content string) (bool, error) {
 	return false, nil
 }
 
-func copyFile(src, dst string) {
+func copyFile(src, dst string) error {
 	reader, err := os.Open(src)
-	util.Check(err)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
 	writer, err := os.Create(dst)
-	util.Check(err)
+	if err != nil {
+		return err
+	}
 	_, err = io.Copy(writer, reader)
-	util.Check(err)
-	writer.Close()
-	reader.Close()
+	if err != nil {
+		writer.Close()
+		return err
+	}
+	return writer.Close()
 }
 
 func populateFiles() {
@@ -1221,12 +1615,15 @@ func populateFiles() {
 	}
 	createIfNotExist("style.css", DEFAULT_CSS)
 	createIfNotExist("symbols", DEFAULT_SYMBOLS)
+	createIfNotExist("config", DEFAULT_CONFIG)
 }
 
 var canonicalUrl string
 var host string
 var generateOG bool
+var ogmap map[string]string // image name -> fingerprint of the text it was rendered from
 var symbols map[string]int
+var config map[string]string
 
 func main() {
 	populateFiles()
@@ -1247,12 +1644,40 @@ func main() {
 	util.Check(err)
 	host = u.Host
 
+	if generateOG && host == "" {
+		fmt.Println("plain: specified preview generation, but the canonical url flag (--url) is not set")
+		echo("not generating previews")
+		generateOG = false
+	}
+
 	parseSymbols()
+	parseConfig()
 	err = os.MkdirAll(OUTPATH, 0777)
 	util.Check(err)
+	if generateOG {
+		ogmap = og.OpenStore()
+	}
+	copymap = openCopyStore()
 	index := readListicle("index")
+	if err := checkConflicts(index); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 	processRootListicle(index)
-	copyFile(cssPath, filepath.Join(OUTPATH, "style.css"))
+	err = saveCopyStore(copymap)
+	util.Check(err)
+	if generateOG {
+		err = og.SaveStore(ogmap)
+		util.Check(err)
+	}
+	err = copyFile(cssPath, filepath.Join(OUTPATH, "style.css"))
+	util.Check(err)
+	if highlightEnabled() {
+		err = writeHighlightStylesheet()
+		util.Check(err)
+	}
+	err = writeRedirectMaps()
+	util.Check(err)
 }
 
 /* rss-ish stuff */
@@ -1267,6 +1692,7 @@ func extractListicleFeedPosts(listicle, nested, canonicalURL string) []rss.FeedI
 	var feed []rss.FeedItem
 	for _, el := range elements {
 		pf := PageFragment{}
+		var route string
 		for _, p := range el.pairs {
 			switch symbol(p.code) {
 			case TITLE:
@@ -1278,8 +1704,14 @@ func extractListicleFeedPosts(listicle, nested, canonicalURL string) []rss.FeedI
 				if nested != "" {
 					linkPath = fmt.Sprintf("%s/%s", nested, linkPath)
 				}
-				pf.link = util.ConstructURL(canonicalURL, linkPath)
+				route = filepath.Join("/", linkPath)
+				pf.link = util.ConstructURL(canonicalURL, routeLink(route))
 			case RENAME:
+				if route != "" {
+					route = filepath.Join(filepath.Dir(route), p.content)
+					pf.link = util.ConstructURL(canonicalURL, routeLink(route))
+					continue
+				}
 				u, err := url.Parse(pf.link)
 				util.Check(err)
 				segments := strings.Split(u.EscapedPath(), "/")
@@ -1298,8 +1730,11 @@ func extractListicleFeedPosts(listicle, nested, canonicalURL string) []rss.FeedI
 		if len(pf.link) > 0 {
 			u, err := url.Parse(pf.link)
 			util.Check(err)
+			// items of pages are stored by their route, which stays the same whichever way the page is linked
 			var id string
-			if len(u.Path) > 0 {
+			if route != "" {
+				id = route
+			} else if len(u.Path) > 0 {
 				id = u.Path
 			} else {
 				id = u.Hostname()
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCSSString(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain path", "/media/cover.png", "/media/cover.png"},
+		{"closing style element", "</style><script>alert(1)</script>", `\3c /style\3e \3c script\3e alert(1)\3c /script\3e `},
+		{"closing quote", `x.png"); } body { display: none`, `x.png\22 ); } body { display: none`},
+		{"backslash", `a\"b`, `a\5c \22 b`},
+		{"newline", "a\nb", `a\a b`},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := cssString(test.in); got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestCSSValue(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"hex color", "#1b3737", "#1b3737"},
+		{"function color", "rgb(27, 55, 55)", "rgb(27, 55, 55)"},
+		{"closing style element", "red</style><script>", "red/stylescript"},
+		{"closing declaration", "red;} body { display: none", "red body  display: none"},
+		{"quotes", `red" onload="alert(1)`, "red onload=alert(1)"},
+		{"url", "url(javascript:alert(1))", ""},
+		{"uppercase url", "URL(https://example.com/track.png)", ""},
+		{"expression", "expression(alert(1))", ""},
+		{"javascript", "javascript:alert(1)", ""},
+		{"escaped url", `u\rl(javascript:alert(1))`, ""},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := cssValue(test.in); got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestThemeStyle(t *testing.T) {
+	tests := []struct {
+		name  string
+		theme Theme
+		want  []string // substrings of the style
+		empty bool
+	}{
+		{"colors", Theme{foreground: "#fff", background: "#000", link: "red"}, []string{"--foreground: #fff !important;", "--background: #000 !important;", "color: red !important;"}, false},
+		{"closing style element", Theme{link: "red;}</style><script>alert(1)</script>"}, []string{"--highlight: red/stylescriptalert(1)/script !important;"}, false},
+		{"url only", Theme{foreground: "url(javascript:alert(1))"}, nil, true},
+		{"url next to a color", Theme{foreground: "url(javascript:alert(1))", background: "#000"}, []string{"--background: #000"}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			style := themeStyle(PageFragment{theme: test.theme})
+			if test.empty {
+				if style != "" {
+					t.Fatalf("expected no style, got %q", style)
+				}
+				return
+			}
+			for _, want := range test.want {
+				if !strings.Contains(style, want) {
+					t.Errorf("expected the style to contain %q, got %q", want, style)
+				}
+			}
+			if strings.Count(style, "</style>") != 1 || strings.Contains(style, "<script") || strings.Contains(style, "url(") {
+				t.Errorf("expected the theme to stay within its declarations, got %q", style)
+			}
+		})
+	}
+}
+
+func TestBackgroundStyle(t *testing.T) {
+	style := backgroundStyle(PageFragment{background: `x.png"); } </style><script>alert(1)</script><style>{`})
+	if strings.Count(style, "</style>") != 1 || strings.Contains(style, "<script") || strings.Count(style, `"`) != 2 {
+		t.Errorf("expected the background to stay within its url string, got %q", style)
+	}
+}
+
+func TestPageMetadata(t *testing.T) {
+	previousHost, previousURL := host, canonicalUrl
+	host, canonicalUrl = "example.com", "https://example.com"
+	defer func() { host, canonicalUrl = previousHost, previousURL }()
+
+	tests := []struct {
+		name string
+		pf   PageFragment
+		want []string // substrings of the metadata
+	}{
+		{
+			name: "brief closing the attribute",
+			pf:   PageFragment{brief: `a "quoted" <b>brief</b>`},
+			want: []string{`<meta name="description" content="a &#34;quoted&#34; &lt;b&gt;brief&lt;/b&gt;">`},
+		},
+		{
+			name: "brief injecting markup",
+			pf:   PageFragment{brief: `"><script>alert(1)</script>`},
+			want: []string{`content="&#34;&gt;&lt;script&gt;alert(1)&lt;/script&gt;"`},
+		},
+		{
+			name: "route closing the canonical link",
+			pf:   PageFragment{route: `/a"><script>`},
+			want: []string{`<link rel="canonical" href="https://example.com/a%22%3E%3Cscript%3E">`},
+		},
+		{
+			name: "metadata with ampersands",
+			pf:   PageFragment{brief: "this & that"},
+			want: []string{`content="this &amp; that"`},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			meta := pageMetadata(test.pf)
+			for _, want := range test.want {
+				if !strings.Contains(meta, want) {
+					t.Errorf("expected the metadata to contain %q, got %q", want, meta)
+				}
+			}
+			if strings.Contains(meta, "<script") || strings.Contains(meta, "<b>") {
+				t.Errorf("expected no markup to be injected, got %q", meta)
+			}
+		})
+	}
+}
+
+func TestCreateHistoryLink(t *testing.T) {
+	previousTitles := routeTitles
+	routeTitles = map[string]string{"/articles": "articles"}
+	defer func() { routeTitles, config = previousTitles, nil }()
+	tests := []struct {
+		route, back, breadcrumbsBack string
+	}{
+		{"/", "", ""},
+		{"/about", "/", "/"},
+		{"/articles/trustnet", "/articles", "/articles"},
+		{"/articles/2023/trustnet", "/articles/2023", "/articles"},
+		{"/projects/plain", "/projects", "/"},
+	}
+	for _, test := range tests {
+		config = nil
+		if got := createHistoryLink(test.route); got != test.back {
+			t.Errorf("expected %s to link back to %q, got %q", test.route, test.back, got)
+		}
+		config = map[string]string{"breadcrumbs": "true"}
+		if got := createHistoryLink(test.route); got != test.breadcrumbsBack {
+			t.Errorf("expected %s to link back to %q with breadcrumbs, got %q", test.route, test.breadcrumbsBack, got)
+		}
+	}
+}
+
+func TestHTMLPreambleTitle(t *testing.T) {
+	inSite(t, map[string]string{"header.html": DEFAULT_HEADER})
+	previousHost, previousURL := host, canonicalUrl
+	host, canonicalUrl = "example.com", "https://example.com"
+	defer func() { host, canonicalUrl = previousHost, previousURL }()
+	tests := []struct {
+		name string
+		pf   PageFragment
+		want []string // substrings of the preamble
+	}{
+		{"untitled page", PageFragment{route: "/"}, []string{"<title>my plain website</title>\n" + `<link rel="canonical" href="https://example.com/">`}},
+		{"titled page", PageFragment{route: "/about", title: "about"}, []string{"<title>about — my plain website</title>", `<link rel="canonical" href="https://example.com/about">`}},
+		{"untitled page with a brief", PageFragment{brief: "a brief"}, []string{"<title>my plain website</title>\n" + `<meta name="description" content="a brief">`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			preamble := htmlPreamble(test.pf)
+			for _, want := range test.want {
+				if !strings.Contains(preamble, want) {
+					t.Errorf("expected the preamble to contain %q, got %q", want, preamble)
+				}
+			}
+			if strings.Count(preamble, "<title>") != 1 {
+				t.Errorf("expected a single <title>, got %q", preamble)
+			}
+		})
+	}
+}
+
+// pages renamed with rn are written at their final route, which their metadata points at
+func TestRenamedPageMetadata(t *testing.T) {
+	symbols = testSymbols
+	inSite(t, map[string]string{"header.html": DEFAULT_HEADER, "footer.html": DEFAULT_FOOTER, "wiki/support.md": "# support\n\nhelp", "articles": "md wiki/support.md\nrn helping\n"})
+	previousHost, previousURL, previousOut := host, canonicalUrl, OUTPATH
+	host, canonicalUrl, OUTPATH = "example.com", "https://example.com", "web"
+	defer func() { host, canonicalUrl, OUTPATH = previousHost, previousURL, previousOut }()
+	extractPageFragments("/", false, readListicle("articles"))
+	page, err := os.ReadFile(filepath.Join("web", "helping", "index.html"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `<link rel="canonical" href="https://example.com/helping">`; !strings.Contains(string(page), want) {
+		t.Errorf("expected the renamed page to contain %q, got %q", want, page)
+	}
+	if _, err := os.Stat(filepath.Join("web", "support")); err == nil {
+		t.Errorf("expected nothing to be written at the route from before the rename")
+	}
+}
+
+// pages without a tt or bb take them from their markdown
+func TestMarkdownFallbacks(t *testing.T) {
+	symbols = testSymbols
+	tests := []struct {
+		name, entry string
+		want        []string // substrings of the written page
+	}{
+		{"from the markdown", "md wiki/support.md\n", []string{"<title>Support — my plain website</title>", `<meta name="description" content="ways to support my work">`, `"headline":"Support"`}},
+		{"tt & bb of its own", "tt Helping\nbb a brief of its own\nmd wiki/support.md\n", []string{"<title>Helping — my plain website</title>", `<meta name="description" content="a brief of its own">`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inSite(t, map[string]string{"header.html": DEFAULT_HEADER, "footer.html": DEFAULT_FOOTER, "wiki/support.md": "# Support\n\nways to support my work\n", "articles": test.entry})
+			previousOut := OUTPATH
+			OUTPATH = "web"
+			defer func() { OUTPATH = previousOut }()
+			extractPageFragments("/", false, readListicle("articles"))
+			page, err := os.ReadFile(filepath.Join("web", "support", "index.html"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(string(page), want) {
+					t.Errorf("expected the page to contain %q, got %q", want, page)
+				}
+			}
+		})
+	}
+}
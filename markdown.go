@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+	"github.com/cblgh/plain/util"
+	"github.com/gomarkdown/markdown"
+	"github.com/gomarkdown/markdown/ast"
+	mdhtml "github.com/gomarkdown/markdown/html"
+	"github.com/gomarkdown/markdown/parser"
+	"html"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// the markdown extensions plain knows by name. an extension enables parser extensions, renderer flags, or both
+var markdownExtensions = map[string]struct {
+	extensions parser.Extensions
+	flags      mdhtml.Flags
+}{
+	"footnotes":        {extensions: parser.Footnotes},
+	"tables":           {extensions: parser.Tables},
+	"fenced-code":      {extensions: parser.FencedCode},
+	"definition-lists": {extensions: parser.DefinitionLists},
+	"heading-ids":      {extensions: parser.AutoHeadingIDs},
+	"strikethrough":    {extensions: parser.Strikethrough},
+	"autolink":         {extensions: parser.Autolink},
+	"hard-line-breaks": {extensions: parser.HardLineBreak},
+	"smartypants":      {flags: mdhtml.Smartypants | mdhtml.SmartypantsFractions | mdhtml.SmartypantsDashes | mdhtml.SmartypantsLatexDashes},
+}
+
+type markdownOptions struct {
+	extensions parser.Extensions
+	flags      mdhtml.Flags
+}
+
+// applies a space-separated list of extension names to opts, e.g. "footnotes -smartypants" enables footnotes and
+// disables smartypants
+func (opts markdownOptions) apply(list string) markdownOptions {
+	for _, name := range strings.Fields(list) {
+		disable := strings.HasPrefix(name, "-")
+		ext, exists := markdownExtensions[strings.TrimPrefix(strings.TrimPrefix(name, "-"), "+")]
+		if !exists {
+			fmt.Printf("plain: unknown markdown extension %q, ignoring it\n", name)
+			continue
+		}
+		if disable {
+			opts.extensions &^= ext.extensions
+			opts.flags &^= ext.flags
+		} else {
+			opts.extensions |= ext.extensions
+			opts.flags |= ext.flags
+		}
+	}
+	return opts
+}
+
+// the site-wide markdown options: gomarkdown's defaults, as modified by the markdown key of the config file, and
+// then by overrides (the page's own list of extensions, if any)
+func markdownSettings(overrides string) markdownOptions {
+	opts := markdownOptions{extensions: parser.CommonExtensions, flags: mdhtml.CommonFlags}
+	return opts.apply(configString("markdown", "")).apply(overrides)
+}
+
+// what plain gathers about a markdown document while rendering it
+type outline struct {
+	title    string    // the text of the document's first # heading
+	summary  string    // the text of the document's first paragraph
+	headings []heading // the anchored h2-h6 headings, used for the table of contents
+}
+
+// renders markdown as html, returning the document's outline along with it
+func renderMarkdown(b []byte, opts markdownOptions) ([]byte, outline) {
+	return renderDocument(parseMarkdown(b, opts), opts)
+}
+
+func parseMarkdown(b []byte, opts markdownOptions) ast.Node {
+	// parsers keep state between documents, so each parse gets a fresh one
+	return markdown.Parse(b, parser.NewWithExtensions(opts.extensions))
+}
+
+// renders a parsed markdown document as html, returning the document's outline along with it
+func renderDocument(doc ast.Node, opts markdownOptions) ([]byte, outline) {
+	o := outline{headings: anchorHeadings(doc)}
+	o.title, o.summary = titleAndSummary(doc)
+	renderer := mdhtml.NewRenderer(mdhtml.RendererOptions{Flags: opts.flags, RenderNodeHook: renderHook})
+	return markdown.Render(doc, renderer), o
+}
+
+// intercepts the rendering of markdown nodes; returning false leaves the node to gomarkdown's html renderer
+func renderHook(w io.Writer, node ast.Node, entering bool) (ast.WalkStatus, bool) {
+	switch n := node.(type) {
+	case *ast.CodeBlock:
+		if highlightEnabled() {
+			return ast.GoToNext, highlightCodeBlock(w, n)
+		}
+	case *ast.Image:
+		// images copied into the media directory are written with their dimensions & variants
+		if r, exists := responsiveImages[string(n.Destination)]; exists {
+			if entering {
+				writeImageTag(w, n, r)
+			}
+			return ast.SkipChildren, true
+		}
+	case *ast.Heading:
+		// append the permalink to the heading's contents, leaving the closing tag to the html renderer
+		if !entering && n.Level >= 2 && n.HeadingID != "" && configBool("permalinks", false) {
+			fmt.Fprintf(w, ` <a class="permalink" href="#%s" aria-label="permalink">#</a>`, html.EscapeString(n.HeadingID))
+		}
+	}
+	return ast.GoToNext, false
+}
+
+/* headings & table of contents */
+
+type heading struct {
+	level int
+	id    string // the heading's anchor, e.g. "getting-started" for "## Getting started"
+	text  string
+}
+
+// gives every h2-h6 of doc a unique anchor id (the parser's, or a slug of its text: notes, notes-1, ..), returning
+// them in document order
+func anchorHeadings(doc ast.Node) []heading {
+	var headings []heading
+	seen := make(map[string]int)
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		h, ok := node.(*ast.Heading)
+		if !ok || !entering || h.Level < 2 || h.IsTitleblock {
+			return ast.GoToNext
+		}
+		text := plainText(h)
+		id := h.HeadingID
+		if id == "" {
+			id = slugify(text)
+		}
+		base := id
+		for _, exists := seen[id]; exists; _, exists = seen[id] {
+			seen[base]++
+			id = fmt.Sprintf("%s-%d", base, seen[base])
+		}
+		seen[id] = 0
+		h.HeadingID = id
+		headings = append(headings, heading{level: h.Level, id: id, text: text})
+		return ast.SkipChildren
+	})
+	return headings
+}
+
+// the plain text of a node, with any markup (emphasis, links, code) and images removed
+func plainText(node ast.Node) string {
+	var b strings.Builder
+	ast.WalkFunc(node, func(node ast.Node, entering bool) ast.WalkStatus {
+		switch n := node.(type) {
+		case *ast.Image:
+			return ast.SkipChildren
+		case *ast.Text:
+			b.Write(n.Literal)
+		case *ast.Code:
+			b.Write(n.Literal)
+		case *ast.Hardbreak, *ast.Softbreak:
+			b.WriteString(" ")
+		}
+		return ast.GoToNext
+	})
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// the longest a summary taken from a document's first paragraph gets, in characters; search engines cut page
+// descriptions at about this length
+const SUMMARY_LENGTH = 200
+
+// the text of the document's first # heading and of its first paragraph (with text in it), used as the title and
+// brief of pages that don't set their own
+func titleAndSummary(doc ast.Node) (string, string) {
+	var title, summary string
+	for _, node := range doc.GetChildren() {
+		switch n := node.(type) {
+		case *ast.Heading:
+			if title == "" && n.Level == 1 {
+				title = plainText(n)
+			}
+		case *ast.Paragraph:
+			if summary == "" {
+				summary = truncateText(plainText(n), SUMMARY_LENGTH)
+			}
+		}
+	}
+	return title, summary
+}
+
+// shortens s to at most max characters, cutting at a word boundary and marking the cut with an ellipsis
+func truncateText(s string, max int) string {
+	runes := []rune(s)
+	if len(runes) <= max {
+		return s
+	}
+	cut := string(runes[:max])
+	if i := strings.LastIndex(cut, " "); i > 0 {
+		cut = cut[:i]
+	}
+	return strings.TrimRight(cut, " ,.;:") + "…"
+}
+
+// lowercases s and joins its runs of letters & numbers with dashes, like heading-ids: "What's new?" -> "what-s-new"
+func slugify(s string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range s {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsNumber(r):
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			dash = false
+			b.WriteRune(unicode.ToLower(r))
+		default:
+			dash = true
+		}
+	}
+	if b.Len() == 0 {
+		return "section"
+	}
+	return b.String()
+}
+
+// whether a page gets a table of contents: its own tc setting if it has one, otherwise toc-min-headings
+func wantsTableOfContents(setting string, headings []heading) bool {
+	if setting != "" {
+		enabled, err := strconv.ParseBool(setting)
+		if err != nil {
+			fmt.Printf("plain: table of contents expects true or false, got %q\n", setting)
+			return false
+		}
+		return enabled && len(headings) > 0
+	}
+	min := configInt("toc-min-headings", 0)
+	return min > 0 && len(headings) >= min
+}
+
+// adds the table of contents after the page's <h1>, if it wants one; untitled pages only get one by asking with tc
+func withTableOfContents(contents, setting string, headings []heading) string {
+	if !wantsTableOfContents(setting, headings) {
+		return contents
+	}
+	if setting == "" && !strings.Contains(contents, "</h1>") {
+		return contents
+	}
+	return injectAfterTitle(contents, tableOfContents(headings))
+}
+
+// renders the headings as nested lists of links, keeping a stack of the open lists' levels as headings may skip some
+func tableOfContents(headings []heading) string {
+	var b strings.Builder
+	b.WriteString(`<nav class="toc" aria-label="table of contents">` + "\n")
+	var levels []int // the heading level of each open list, innermost last
+	for _, h := range headings {
+		if len(levels) == 0 || h.level > levels[len(levels)-1] {
+			b.WriteString("<ul>\n")
+			levels = append(levels, h.level)
+		} else {
+			b.WriteString("</li>\n")
+			for len(levels) > 1 && h.level < levels[len(levels)-1] {
+				levels = levels[:len(levels)-1]
+				b.WriteString("</ul>\n")
+				if h.level > levels[len(levels)-1] {
+					// between the enclosing list's level and the closed one's (h2, h4, h3): nest a list of its own
+					b.WriteString("<ul>\n")
+					levels = append(levels, h.level)
+					break
+				}
+				b.WriteString("</li>\n")
+			}
+			if len(levels) == 1 && h.level < levels[0] {
+				// the page started deeper than this heading (h3, h2)
+				levels[0] = h.level
+			}
+		}
+		fmt.Fprintf(&b, `<li><a href="#%s">%s</a>`, html.EscapeString(h.id), html.EscapeString(h.text))
+	}
+	b.WriteString("</li>\n")
+	for len(levels) > 0 {
+		levels = levels[:len(levels)-1]
+		b.WriteString("</ul>\n")
+		if len(levels) > 0 {
+			b.WriteString("</li>\n")
+		}
+	}
+	b.WriteString("</nav>\n")
+	return b.String()
+}
+
+// inserts s right after the document's first <h1>, or at the very top if there is none
+func injectAfterTitle(contents, s string) string {
+	start := strings.Index(contents, "<h1")
+	end := strings.Index(contents, "</h1>")
+	if start == -1 || end < start {
+		return s + "\n" + contents
+	}
+	end += len("</h1>")
+	return contents[:end] + "\n" + s + contents[end:]
+}
+
+/* syntax highlighting */
+// fenced code blocks are highlighted as they are rendered, with each token wrapped in a span whose class names its
+// type (e.g. <span class="k"> for keywords). the colors live in a generated stylesheet, highlight.css, so that no
+// javascript is needed to view highlighted code
+
+const HIGHLIGHT_STYLESHEET = "highlight.css"
+
+var highlightFormatter = chromahtml.New(chromahtml.WithClasses(true), chromahtml.PreventSurroundingPre(true))
+
+var highlightReported = make(map[string]bool) // the unknown styles & languages reported so far, each reported once
+
+func highlightEnabled() bool {
+	return configBool("highlight", false)
+}
+
+// the chroma style the stylesheet is generated from, see https://xyproto.github.io/splash/docs/
+func highlightStyle() *chroma.Style {
+	name := configString("highlight-style", "github")
+	if _, exists := styles.Registry[name]; !exists && !highlightReported["style "+name] {
+		highlightReported["style "+name] = true
+		fmt.Printf("plain: unknown highlight style %q, using the fallback style\n", name)
+	}
+	return styles.Get(name)
+}
+
+// writes the highlighted code block to w, reporting false if the block's language is unset or unknown
+func highlightCodeBlock(w io.Writer, block *ast.CodeBlock) bool {
+	info := strings.Fields(string(block.Info))
+	if len(info) == 0 {
+		return false
+	}
+	lang := info[0]
+	lexer := lexers.Get(lang)
+	if lexer == nil {
+		if !highlightReported["language "+lang] {
+			highlightReported["language "+lang] = true
+			fmt.Printf("plain: unknown language %q, leaving its code blocks unhighlighted\n", lang)
+		}
+		return false
+	}
+	iterator, err := chroma.Coalesce(lexer).Tokenise(nil, string(block.Literal))
+	if err != nil {
+		return false
+	}
+	fmt.Fprintf(w, `<pre class="chroma"><code class="language-%s">`, html.EscapeString(lang))
+	err = highlightFormatter.Format(w, highlightStyle(), iterator)
+	util.Check(err)
+	io.WriteString(w, "</code></pre>\n")
+	return true
+}
+
+// writes the stylesheet for highlighted code into the webroot, next to style.css
+func writeHighlightStylesheet() error {
+	f, err := os.Create(filepath.Join(OUTPATH, HIGHLIGHT_STYLESHEET))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return highlightFormatter.WriteCSS(f, highlightStyle())
+}
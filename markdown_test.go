@@ -0,0 +1,193 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var tocTag = regexp.MustCompile(`</?(ul|li|nav)\b[^>]*>|<a href="#([^"]*)">`)
+
+// checks that the lists of a table of contents are validly nested (every <li> directly in a <ul>, every nested <ul>
+// directly in an <li>), returning the depth at which each heading's link was found
+func tocDepths(t *testing.T, toc string) map[string]int {
+	t.Helper()
+	depths := make(map[string]int)
+	var open []string
+	for _, match := range tocTag.FindAllStringSubmatch(toc, -1) {
+		tag := match[0]
+		parent := ""
+		if len(open) > 0 {
+			parent = open[len(open)-1]
+		}
+		switch {
+		case match[2] != "":
+			depths[match[2]] = strings.Count(strings.Join(open, " "), "ul")
+		case strings.HasPrefix(tag, "</"):
+			if parent != match[1] {
+				t.Fatalf("%s closes <%s> in %s", tag, parent, toc)
+			}
+			open = open[:len(open)-1]
+		default:
+			if (match[1] == "li" && parent != "ul") || (match[1] == "ul" && parent != "li" && parent != "nav") {
+				t.Fatalf("<%s> opened within <%s> in %s", match[1], parent, toc)
+			}
+			open = append(open, match[1])
+		}
+	}
+	if len(open) != 0 {
+		t.Fatalf("%v left open in %s", open, toc)
+	}
+	return depths
+}
+
+func TestTableOfContents(t *testing.T) {
+	tests := []struct {
+		name   string
+		levels []int
+		depths []int
+	}{
+		{"flat", []int{2, 2, 2}, []int{1, 1, 1}},
+		{"nested", []int{2, 3, 3, 2}, []int{1, 2, 2, 1}},
+		{"skipped level", []int{2, 4, 2}, []int{1, 2, 1}},
+		{"back up by one of two skipped levels", []int{2, 4, 3}, []int{1, 2, 2}},
+		{"deeper after backing up", []int{2, 4, 3, 4}, []int{1, 2, 2, 3}},
+		{"back up several levels", []int{2, 3, 4, 2}, []int{1, 2, 3, 1}},
+		{"back up past skipped levels", []int{2, 6, 4, 2}, []int{1, 2, 2, 1}},
+		{"starting deep", []int{3, 2, 3}, []int{1, 1, 2}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var headings []heading
+			for i, level := range test.levels {
+				id := fmt.Sprintf("h%d", i)
+				headings = append(headings, heading{level: level, id: id, text: id})
+			}
+			depths := tocDepths(t, tableOfContents(headings))
+			for i, want := range test.depths {
+				if got := depths[headings[i].id]; got != want {
+					t.Errorf("expected heading %d (h%d) at depth %d, got %d", i, test.levels[i], want, got)
+				}
+			}
+		})
+	}
+}
+
+func TestWithTableOfContents(t *testing.T) {
+	config = map[string]string{"toc-min-headings": "2"}
+	defer func() { config = nil }()
+	headings := []heading{{level: 2, id: "a", text: "a"}, {level: 2, id: "b", text: "b"}}
+	tests := []struct {
+		name, contents, setting string
+		toc                     string // where the table of contents is expected: "after title", "top" or "none"
+	}{
+		{"titled page over the minimum", "<h1>title</h1>\n<h2>a</h2>", "", "after title"},
+		{"untitled page over the minimum", "<h2>a</h2>\n<h2>b</h2>", "", "none"},
+		{"untitled page asking for one", "<h2>a</h2>\n<h2>b</h2>", "true", "top"},
+		{"titled page opting out", "<h1>title</h1>\n<h2>a</h2>", "false", "none"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := withTableOfContents(test.contents, test.setting, headings)
+			var want string
+			switch test.toc {
+			case "after title":
+				want = injectAfterTitle(test.contents, tableOfContents(headings))
+			case "top":
+				want = tableOfContents(headings) + "\n" + test.contents
+			default:
+				want = test.contents
+			}
+			if got != want {
+				t.Errorf("expected %q, got %q", want, got)
+			}
+		})
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	config = map[string]string{"highlight": "true"}
+	defer func() { config = nil }()
+	highlightReported = make(map[string]bool)
+	tests := []struct {
+		name, markdown string
+		want           string // a substring of the rendered html
+	}{
+		{"known language", "```go\nfunc main() {}\n```\n", `<pre class="chroma"><code class="language-go"><span class="kd">func</span>`},
+		{"unknown language", "```nosuchlang\na\n```\n\n```nosuchlang\nb\n```\n", `<code class="language-nosuchlang">b`},
+		{"no language", "```\nplain\n```\n", "<pre><code>plain"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			html, _ := renderMarkdown([]byte(test.markdown), markdownSettings(""))
+			if !strings.Contains(string(html), test.want) {
+				t.Errorf("expected %q in %q", test.want, html)
+			}
+		})
+	}
+	if len(highlightReported) != 1 || !highlightReported["language nosuchlang"] {
+		t.Errorf("expected the unknown language to be reported once, got %v", highlightReported)
+	}
+}
+
+// section wikilinks point at the anchors given to the headings they name
+func TestSectionWikilinks(t *testing.T) {
+	doc := parseMarkdown([]byte("# Notes\n\n## Getting started\n\n## What's new?\n\n## Notes\n\n## Notes\n"), markdownSettings(""))
+	anchors := make(map[string]bool)
+	for _, h := range anchorHeadings(doc) {
+		anchors[h.id] = true
+	}
+	tests := []struct {
+		subject, want string
+	}{
+		{"wiki", "/wiki"},
+		{"Wiki", "/wiki"},
+		{"wiki#Getting started", "/wiki#getting-started"},
+		{"wiki#What's new?", "/wiki#what-s-new"},
+		{"#getting-started", "#getting-started"},
+		{"#Notes", "#notes"},
+	}
+	for _, test := range tests {
+		got := wikilinkTarget(test.subject)
+		if got != test.want {
+			t.Errorf("expected [[%s]] to link to %q, got %q", test.subject, test.want, got)
+		}
+		if i := strings.Index(got, "#"); i != -1 && !anchors[got[i+1:]] {
+			t.Errorf("expected [[%s]] to link to one of the headings' anchors %v, got %q", test.subject, anchors, got)
+		}
+	}
+	if !anchors["notes-1"] {
+		t.Errorf("expected a repeated heading to be suffixed with a count, got %v", anchors)
+	}
+	html, _ := renderMarkdown(transformWikilinks([]byte("see [[wiki#Getting started]]")), markdownSettings(""))
+	if want := `<a href="/wiki#getting-started">wiki#Getting started</a>`; !strings.Contains(string(html), want) {
+		t.Errorf("expected %q in %q", want, html)
+	}
+}
+
+func TestTitleAndSummary(t *testing.T) {
+	long := strings.Repeat("a sentence of some length, ", 12)
+	tests := []struct {
+		name, markdown, title, summary string
+	}{
+		{"heading & paragraph", "# Support\n\nways to *support* my work\n\nmore", "Support", "ways to support my work"},
+		{"no heading", "just a [paragraph](/somewhere)\n", "", "just a paragraph"},
+		{"heading after the paragraph", "intro\n\n# Title\n", "Title", "intro"},
+		{"only deeper headings", "## Section\n\ntext\n", "", "text"},
+		{"image before the text", "# Title\n\n![cover](cover.png)\n\nthe text\n", "Title", "the text"},
+		{"empty", "", "", ""},
+		{"long paragraph", "# Title\n\n" + long, "Title", truncateText(strings.TrimSpace(long), SUMMARY_LENGTH)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			_, o := renderMarkdown([]byte(test.markdown), markdownSettings(""))
+			if o.title != test.title || o.summary != test.summary {
+				t.Errorf("expected title %q and summary %q, got %q and %q", test.title, test.summary, o.title, o.summary)
+			}
+			if len([]rune(o.summary)) > SUMMARY_LENGTH+1 {
+				t.Errorf("expected the summary to be at most %d characters, got %d", SUMMARY_LENGTH, len([]rune(o.summary)))
+			}
+		})
+	}
+}
@@ -0,0 +1,322 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/gomarkdown/markdown/ast"
+	xdraw "golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+	"html"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// images, and other local files linked from markdown (pdfs, audio, zips, ..), are copied into the media directory
+// under content-addressed names: img/cover.png is stored as media/cover-1a2b3c4d5e.png, after the hash of its
+// contents. two different files named cover.png no longer overwrite each other, while a file used by several pages is
+// stored (and copied) only once
+
+const MEDIA_DIR = "media"
+
+var persistedMedia = make(map[string]string) // the source path of each file copied during this build -> its web path
+
+// copies the images & files referenced by the markdown document at location into the media directory, pointing the
+// document's images & links at the copies. images that can't be found are reported and left as they are, as are
+// links that don't point at a file (such as links to other pages of the site)
+func persistMedia(location string, doc ast.Node) error {
+	var err error
+	ast.WalkFunc(doc, func(node ast.Node, entering bool) ast.WalkStatus {
+		if !entering {
+			return ast.GoToNext
+		}
+		switch n := node.(type) {
+		case *ast.Image:
+			path, _, local := localPath(string(n.Destination))
+			if !local {
+				return ast.GoToNext
+			}
+			src, inside := resolvePath(location, path)
+			if !inside {
+				fmt.Printf("plain: %s: image %s is outside of the site's and the markdown's directories (see media-dirs), leaving its link as is\n", location, n.Destination)
+				return ast.GoToNext
+			}
+			if _, statErr := os.Stat(src); statErr != nil {
+				fmt.Printf("plain: %s: image %s not found (looked for %s), leaving its link as is\n", location, n.Destination, src)
+				return ast.GoToNext
+			}
+			webpath, copyErr := persistMediaFile(src)
+			if copyErr == nil && len(imageWidths()) > 0 {
+				copyErr = resizeImage(src, webpath)
+			}
+			if copyErr != nil {
+				err = copyErr
+				return ast.Terminate
+			}
+			n.Destination = []byte(webpath)
+		case *ast.Link:
+			path, fragment, local := localPath(string(n.Destination))
+			// absolute links, such as [articles](/articles), point at the site's own pages rather than at files
+			if !local || filepath.IsAbs(path) || filepath.Ext(path) == ".md" {
+				return ast.GoToNext
+			}
+			src, inside := resolvePath(location, path)
+			if !inside {
+				fmt.Printf("plain: %s: link to %s is outside of the site's and the markdown's directories (see media-dirs), leaving it as is\n", location, n.Destination)
+				return ast.GoToNext
+			}
+			if info, statErr := os.Stat(src); statErr != nil || !info.Mode().IsRegular() {
+				return ast.GoToNext
+			}
+			webpath, copyErr := persistMediaFile(src)
+			if copyErr != nil {
+				err = copyErr
+				return ast.Terminate
+			}
+			if fragment != "" {
+				webpath += "#" + fragment
+			}
+			n.Destination = []byte(webpath)
+		}
+		return ast.GoToNext
+	})
+	return err
+}
+
+// copies the file at src into the media directory, returning the web path of the copy
+func persistMediaFile(src string) (string, error) {
+	src = filepath.Clean(src)
+	if webpath, exists := persistedMedia[src]; exists {
+		return webpath, nil
+	}
+	hash, err := fileHash(src)
+	if err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(src)
+	name := fmt.Sprintf("%s-%s%s", strings.TrimSuffix(filepath.Base(src), ext), hash[:10], ext)
+	dst := filepath.Join(OUTPATH, MEDIA_DIR, name)
+	// make sure the <OUTPATH>/media dir exists
+	err = os.MkdirAll(filepath.Dir(dst), 0777)
+	if err != nil {
+		return "", err
+	}
+	// the name is derived from the file's contents: if it exists (e.g. from a previous build), it's the same file
+	if _, err = os.Stat(dst); errors.Is(err, os.ErrNotExist) {
+		echo(fmt.Sprintf("copying %s to %s\n", src, dst))
+		err = copyFile(src, dst)
+	}
+	if err != nil {
+		return "", err
+	}
+	webpath := filepath.Join("/", MEDIA_DIR, name)
+	persistedMedia[src] = webpath
+	return webpath, nil
+}
+
+// hex-encoded sha256 of the file's contents
+func fileHash(filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err = io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// the path & fragment of a link's destination, if it points at a local file rather than a remote url (https://,
+// mailto:, ..). destinations are urls, so escapes such as %20 are undone, and any query dropped
+func localPath(destination string) (string, string, bool) {
+	u, err := url.Parse(destination)
+	if err != nil || u.Scheme != "" || u.Host != "" || u.Path == "" {
+		return "", "", false
+	}
+	return u.Path, u.Fragment, true
+}
+
+// the path on disk of a file referenced from the markdown file at location: relative paths are relative to the
+// markdown file's directory (img/cover.png in wiki/life/support.md is wiki/life/img/cover.png), while absolute paths
+// are used as they are. only files within the site's directory, the markdown file's directory, or a directory listed
+// by media-dirs are copied, so that markdown can't publish arbitrary files of the machine building the site (e.g.
+// ![](/etc/hosts) or ![](../../.ssh/id_rsa))
+func resolvePath(location, path string) (string, bool) {
+	resolved := path
+	if !filepath.IsAbs(path) {
+		resolved = filepath.Join(filepath.Dir(location), path)
+	}
+	abs, err := filepath.Abs(resolved)
+	if err != nil {
+		return "", false
+	}
+	roots := append([]string{".", filepath.Dir(location)}, strings.Fields(configString("media-dirs", ""))...)
+	for _, root := range roots {
+		root, err = filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(root, abs)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return resolved, true
+		}
+	}
+	return "", false
+}
+
+/* responsive images */
+// if image-widths is set, images in markdown are also resized to each of its widths (narrower than the image itself).
+// the variants are named after the copy they were made from and the settings they were made with, e.g.
+// media/cover-1a2b3c4d5e-640w.png or media/photo-5e4d3c2b1a-640w-q85.jpg, and as the copy is named after its contents,
+// variants that exist from a previous build are reused as they are, while changed settings generate new ones. the
+// <img> tags of the images list their variants in srcset, and carry their dimensions (avoiding layout shifts as the
+// page loads) and loading="lazy"
+
+type responsiveImage struct {
+	width, height int
+	srcset        string // the image's resized variants, e.g. "/media/cover-1a2b3c4d5e-640w.png 640w, ..."
+}
+
+var responsiveImages = make(map[string]responsiveImage) // the web path of each copied image -> its dimensions & variants
+
+// the widths images are resized to, in pixels
+func imageWidths() []int {
+	var widths []int
+	for _, field := range strings.Fields(configString("image-widths", "")) {
+		width, err := strconv.Atoi(field)
+		if err != nil || width <= 0 {
+			log.Fatalln(fmt.Sprintf("config: image-widths expects a list of widths in pixels, got %q", field))
+		}
+		widths = append(widths, width)
+	}
+	return widths
+}
+
+// records the dimensions of the image at src (copied to webpath), generating its resized variants. images that
+// can't be decoded, such as svgs, are used as they are
+func resizeImage(src, webpath string) error {
+	if _, exists := responsiveImages[webpath]; exists {
+		return nil
+	}
+	f, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	dims, format, err := image.DecodeConfig(f)
+	if err != nil {
+		echo("not resizing", src, err)
+		return nil
+	}
+	r := responsiveImage{width: dims.Width, height: dims.Height}
+	// resizing a gif would lose its animation
+	if format == "gif" {
+		responsiveImages[webpath] = r
+		return nil
+	}
+
+	var img image.Image // only decoded if a variant needs to be generated
+	var srcset []string
+	for _, width := range imageWidths() {
+		if width >= dims.Width {
+			continue
+		}
+		variant := strings.TrimSuffix(webpath, filepath.Ext(webpath)) + variantSuffix(width, format)
+		dst := filepath.Join(OUTPATH, variant)
+		if _, err = os.Stat(dst); errors.Is(err, os.ErrNotExist) {
+			if img == nil {
+				if _, err = f.Seek(0, io.SeekStart); err != nil {
+					return err
+				}
+				if img, _, err = image.Decode(f); err != nil {
+					return fmt.Errorf("%s: %w", src, err)
+				}
+			}
+			echo("resizing", src, "to", dst)
+			err = writeVariant(img, width, dims.Height*width/dims.Width, format, dst)
+		}
+		if err != nil {
+			return err
+		}
+		srcset = append(srcset, fmt.Sprintf("%s %dw", variant, width))
+	}
+	if len(srcset) > 0 {
+		srcset = append(srcset, fmt.Sprintf("%s %dw", webpath, dims.Width))
+		r.srcset = strings.Join(srcset, ", ")
+	}
+	responsiveImages[webpath] = r
+	return nil
+}
+
+// the quality resized jpegs are encoded with (1-100)
+func imageQuality() int {
+	quality := configInt("image-quality", 85)
+	if quality < 1 || quality > 100 {
+		log.Fatalln(fmt.Sprintf("config: image-quality expects a quality between 1 and 100, got %d", quality))
+	}
+	return quality
+}
+
+// jpegs are resized into jpegs (named after the quality they're encoded with), while other formats (png, webp) are
+// resized into pngs
+func variantSuffix(width int, format string) string {
+	if format == "jpeg" {
+		return fmt.Sprintf("-%dw-q%d.jpg", width, imageQuality())
+	}
+	return fmt.Sprintf("-%dw.png", width)
+}
+
+func writeVariant(img image.Image, width, height int, format, dst string) error {
+	if height < 1 {
+		height = 1
+	}
+	resized := image.NewRGBA(image.Rect(0, 0, width, height))
+	xdraw.CatmullRom.Scale(resized, resized.Bounds(), img, img.Bounds(), xdraw.Over, nil)
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if format == "jpeg" {
+		err = jpeg.Encode(f, resized, &jpeg.Options{Quality: imageQuality()})
+	} else {
+		err = png.Encode(f, resized)
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// writes the <img> tag of a copied image, including its dimensions & variants
+func writeImageTag(w io.Writer, img *ast.Image, r responsiveImage) {
+	var alt strings.Builder
+	for _, child := range img.Children {
+		alt.WriteString(plainText(child))
+	}
+	attributes := []string{
+		fmt.Sprintf(`src="%s"`, html.EscapeString(string(img.Destination))),
+		fmt.Sprintf(`alt="%s"`, html.EscapeString(alt.String())),
+	}
+	if len(img.Title) > 0 {
+		attributes = append(attributes, fmt.Sprintf(`title="%s"`, html.EscapeString(string(img.Title))))
+	}
+	attributes = append(attributes, fmt.Sprintf(`width="%d" height="%d"`, r.width, r.height))
+	if r.srcset != "" {
+		attributes = append(attributes, fmt.Sprintf(`srcset="%s"`, html.EscapeString(r.srcset)))
+		attributes = append(attributes, fmt.Sprintf(`sizes="%s"`, html.EscapeString(configString("image-sizes", "100vw"))))
+	}
+	attributes = append(attributes, `loading="lazy"`)
+	fmt.Fprintf(w, "<img %s />", strings.Join(attributes, " "))
+}
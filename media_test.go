@@ -0,0 +1,86 @@
+package main
+
+import (
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolvePath(t *testing.T) {
+	inSite(t, nil)
+	wiki := t.TempDir()   // markdown kept outside of the site, e.g. md ../wiki/notes.md
+	photos := t.TempDir() // listed by media-dirs
+	tests := []struct {
+		name, location, path string
+		config               map[string]string
+		want                 string // the resolved path, or "" if it's refused
+	}{
+		{"next to the markdown", "wiki/life/support.md", "img/cover.png", nil, "wiki/life/img/cover.png"},
+		{"elsewhere in the site", "wiki/life/support.md", "../img/cover.png", nil, "wiki/img/cover.png"},
+		{"out of the site", "wiki/life/support.md", "../../../secret.png", nil, ""},
+		{"absolute path of the host", "wiki/life/support.md", "/etc/hosts", nil, ""},
+		{"markdown outside of the site", filepath.Join(wiki, "notes.md"), "img/cover.png", nil, filepath.Join(wiki, "img/cover.png")},
+		{"absolute path next to the markdown", filepath.Join(wiki, "notes.md"), filepath.Join(wiki, "img/cover.png"), nil, filepath.Join(wiki, "img/cover.png")},
+		{"out of the markdown's directory", filepath.Join(wiki, "notes.md"), "../secret.png", nil, ""},
+		{"cleaned out of the markdown's directory", filepath.Join(wiki, "notes.md"), "img/../../secret.png", nil, ""},
+		{"unlisted directory", "wiki/support.md", filepath.Join(photos, "cover.png"), nil, ""},
+		{"listed directory", "wiki/support.md", filepath.Join(photos, "cover.png"), map[string]string{"media-dirs": photos}, filepath.Join(photos, "cover.png")},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			config = test.config
+			defer func() { config = nil }()
+			got, inside := resolvePath(test.location, test.path)
+			if inside != (test.want != "") || got != test.want {
+				t.Errorf("expected %q (allowed: %v), got %q (allowed: %v)", test.want, test.want != "", got, inside)
+			}
+		})
+	}
+}
+
+func TestImageWidths(t *testing.T) {
+	tests := []struct {
+		name   string
+		config map[string]string
+		want   []string // substrings of the rendered page
+		absent []string
+	}{
+		{"resizing off", nil, []string{`<img src="/media/cover-`}, []string{"srcset", "width=", "loading="}},
+		{"resizing on", map[string]string{"image-widths": "8 64"}, []string{`-8w.png 8w`, `width="16" height="16"`, `loading="lazy"`}, []string{"-64w.png"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inSite(t, map[string]string{"wiki/notes.md": "![cover](img/cover.png)\n", "wiki/img/.keep": ""})
+			cover, err := os.Create("wiki/img/cover.png")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := png.Encode(cover, image.NewRGBA(image.Rect(0, 0, 16, 16))); err != nil {
+				t.Fatal(err)
+			}
+			cover.Close()
+			config = test.config
+			previousOut := OUTPATH
+			OUTPATH = "web"
+			persistedMedia, responsiveImages = make(map[string]string), make(map[string]responsiveImage)
+			defer func() { config, OUTPATH = nil, previousOut }()
+			md, err := ReadMarkdownFile("wiki/notes.md", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(md.contents, want) {
+					t.Errorf("expected the page to contain %q, got %q", want, md.contents)
+				}
+			}
+			for _, absent := range test.absent {
+				if strings.Contains(md.contents, absent) {
+					t.Errorf("expected the page not to contain %q, got %q", absent, md.contents)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/cblgh/plain/util"
+	"html"
+	"sort"
+	"strings"
+)
+
+// the main navigation is built from the nn commands of the index. items are sorted by their order (no), keeping the
+// index order for items of equal order, and items declaring a group (ng) are nested under the item with that title.
+// if no item has the group's title, the group is rendered as a plain label
+
+// arranges the flat list of navigation items declared in the index into the sorted navigation tree
+func buildNavigation(items []navigation) []navigation {
+	var declared []navigation
+	for _, item := range items {
+		if item.text != "" {
+			declared = append(declared, item)
+		}
+	}
+	sort.SliceStable(declared, func(i, j int) bool {
+		return declared[i].order < declared[j].order
+	})
+
+	var tree []navigation
+	indexOf := func(text string) int {
+		for i, item := range tree {
+			if item.text == text {
+				return i
+			}
+		}
+		return -1
+	}
+	for _, item := range declared {
+		if item.group != "" {
+			continue
+		}
+		// items are told apart by their route: a route declared by several groups of the index is listed once
+		i := indexOf(item.text)
+		if i != -1 && tree[i].link == item.link {
+			continue
+		}
+		if i != -1 {
+			fmt.Printf("plain: navigation: %s and %s are both titled %q; items grouped under it (ng) are nested under %s\n", tree[i].link, item.link, item.text, tree[i].link)
+		}
+		tree = append(tree, item)
+	}
+	for _, item := range declared {
+		if item.group == "" {
+			continue
+		}
+		i := indexOf(item.group)
+		if i == -1 {
+			tree = append(tree, navigation{text: item.group})
+			i = len(tree) - 1
+		}
+		if !containsItem(tree[i].children, item) {
+			tree[i].children = append(tree[i].children, item)
+		}
+	}
+	return tree
+}
+
+// reports whether items holds an item with the same title & route as item
+func containsItem(items []navigation, item navigation) bool {
+	for _, other := range items {
+		if other.text == item.text && other.link == item.link {
+			return true
+		}
+	}
+	return false
+}
+
+// reports whether the navigation link points at the page itself (current), or at the page or one of its ancestors
+// (active): a route the page is nested under, or the listicle an article is listed in
+func navState(link string, pf PageFragment) (bool, bool) {
+	if link == "" {
+		return false, false
+	}
+	route := strings.TrimSuffix(pf.route, "/")
+	link = strings.TrimSuffix(link, "/")
+	current := route == link
+	nested := link != "" && strings.HasPrefix(route, link+"/")
+	listed := pf.article && strings.TrimSuffix(pf.webpath, "/") == link
+	return current, current || nested || listed
+}
+
+func (nav navigation) active(pf PageFragment) bool {
+	if _, active := navState(nav.link, pf); active {
+		return true
+	}
+	for _, child := range nav.children {
+		if child.active(pf) {
+			return true
+		}
+	}
+	return false
+}
+
+func renderNavigation(items []navigation, pf PageFragment) string {
+	var out string
+	for _, nav := range items {
+		current, _ := navState(nav.link, pf)
+		var attributes string
+		if current {
+			attributes = ` class="active" aria-current="page"`
+		} else if nav.active(pf) {
+			attributes = ` class="active" aria-current="true"`
+		}
+		item := fmt.Sprintf(`<span%s>%s</span>`, attributes, html.EscapeString(nav.text))
+		if nav.link != "" {
+			item = fmt.Sprintf(`<a href="%s"%s>%s</a>`, html.EscapeString(routeLink(nav.link)), attributes, html.EscapeString(nav.text))
+		}
+		if len(nav.children) > 0 {
+			out += fmt.Sprintf(`<li class="nav-group">%s<ul>%s</ul></li>`, item, renderNavigation(nav.children, pf))
+		} else {
+			out += fmt.Sprintf(`<li>%s</li>`, item)
+		}
+	}
+	return out
+}
+
+// the closest route declared in the index that route is nested under, defaulting to the root
+func parentRoute(route string) string {
+	for route != "/" && route != "" {
+		route = strings.TrimSuffix(route, "/")
+		route = route[:strings.LastIndex(route, "/")+1]
+		if _, declared := routeTitles[strings.TrimSuffix(route, "/")]; declared && route != "/" {
+			return strings.TrimSuffix(route, "/")
+		}
+	}
+	return "/"
+}
+
+// the name of a route: its navigation title if it has one, otherwise the title it was declared with, falling back to
+// the route's last segment
+func routeLabel(route string) string {
+	var find func(items []navigation) string
+	find = func(items []navigation) string {
+		for _, item := range items {
+			if item.link == route && item.text != "" {
+				return item.text
+			}
+			if text := find(item.children); text != "" {
+				return text
+			}
+		}
+		return ""
+	}
+	if text := find(navElements); text != "" {
+		return text
+	}
+	if title := routeTitles[route]; title != "" {
+		return title
+	}
+	if route == "/" {
+		return "home"
+	}
+	return route[strings.LastIndex(strings.TrimSuffix(route, "/"), "/")+1:]
+}
+
+// the trail of routes leading from the root to the page, ending with the page itself (which has no link). returns
+// nothing if breadcrumbs are disabled, or if the page has no parent
+func breadcrumbs(pf PageFragment) []navigation {
+	if !configBool("breadcrumbs", false) || pf.webpath == "" {
+		return nil
+	}
+	var trail []navigation
+	title := pf.title
+	if title == "" {
+		title = routeLabel(pf.route)
+	}
+	trail = append(trail, navigation{text: title})
+	route := pf.webpath
+	for {
+		if _, declared := routeTitles[route]; declared || route != "/" {
+			trail = append([]navigation{{link: routeLink(route), text: routeLabel(route)}}, trail...)
+		}
+		if route == "/" {
+			break
+		}
+		route = parentRoute(route)
+	}
+	return trail
+}
+
+func renderBreadcrumbs(crumbs []navigation) string {
+	if len(crumbs) == 0 {
+		return ""
+	}
+	var items string
+	for _, crumb := range crumbs {
+		if crumb.link == "" {
+			items += fmt.Sprintf(`<li aria-current="page">%s</li>`, html.EscapeString(crumb.text))
+		} else {
+			items += fmt.Sprintf(`<li><a href="%s">%s</a></li>`, html.EscapeString(crumb.link), html.EscapeString(crumb.text))
+		}
+	}
+	return fmt.Sprintf(`
+  <nav aria-label="breadcrumbs" class="breadcrumbs"><ol>%s</ol></nav>`, items)
+}
+
+type breadcrumbItem struct {
+	Type     string `json:"@type"`
+	Position int    `json:"position"`
+	Name     string `json:"name"`
+	Item     string `json:"item,omitempty"`
+}
+
+type breadcrumbSchema struct {
+	Context string           `json:"@context"`
+	Type    string           `json:"@type"`
+	Items   []breadcrumbItem `json:"itemListElement"`
+}
+
+// describes the breadcrumbs as a schema.org BreadcrumbList, returned as a JSON-LD script tag
+func breadcrumbStructuredData(crumbs []navigation) string {
+	schema := breadcrumbSchema{Context: "https://schema.org", Type: "BreadcrumbList"}
+	for i, crumb := range crumbs {
+		item := breadcrumbItem{Type: "ListItem", Position: i + 1, Name: crumb.text}
+		if crumb.link != "" {
+			item.Item = util.ConstructURL(canonicalUrl, crumb.link)
+		}
+		schema.Items = append(schema.Items, item)
+	}
+	b, err := json.Marshal(schema)
+	util.Check(err)
+	return fmt.Sprintf(`<script type="application/ld+json">%s</script>`, b)
+}
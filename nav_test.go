@@ -0,0 +1,62 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// the navigation tree as "text link" strings, children indented below their parent
+func flattenNavigation(items []navigation, indent string) []string {
+	var out []string
+	for _, item := range items {
+		out = append(out, indent+item.text+" "+item.link)
+		out = append(out, flattenNavigation(item.children, indent+"  ")...)
+	}
+	return out
+}
+
+func TestBuildNavigation(t *testing.T) {
+	tests := []struct {
+		name  string
+		items []navigation
+		want  []string
+	}{
+		{
+			name:  "ordered",
+			items: []navigation{{text: "articles", link: "/articles", order: 2}, {text: "home", link: "/", order: 1}, {link: "/support"}},
+			want:  []string{"home /", "articles /articles"},
+		},
+		{
+			name:  "grouped",
+			items: []navigation{{text: "colophon", link: "/about/colophon", group: "about"}, {text: "about", link: "/about"}},
+			want:  []string{"about /about", "  colophon /about/colophon"},
+		},
+		{
+			name:  "group without an item",
+			items: []navigation{{text: "lieu", link: "/lieu", group: "projects"}},
+			want:  []string{"projects ", "  lieu /lieu"},
+		},
+		{
+			name:  "same title under different groups",
+			items: []navigation{{text: "about", link: "/about"}, {text: "projects", link: "/projects"}, {text: "notes", link: "/about/notes", group: "about"}, {text: "notes", link: "/projects/notes", group: "projects"}},
+			want:  []string{"about /about", "  notes /about/notes", "projects /projects", "  notes /projects/notes"},
+		},
+		{
+			name:  "same title for different routes",
+			items: []navigation{{text: "notes", link: "/notes"}, {text: "notes", link: "/wiki/notes"}, {text: "todo", link: "/notes/todo", group: "notes"}},
+			want:  []string{"notes /notes", "  todo /notes/todo", "notes /wiki/notes"},
+		},
+		{
+			name:  "route declared twice",
+			items: []navigation{{text: "home", link: "/"}, {text: "home", link: "/"}, {text: "now", link: "/now", group: "home"}, {text: "now", link: "/now", group: "home"}},
+			want:  []string{"home /", "  now /now"},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := flattenNavigation(buildNavigation(test.items), ""); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
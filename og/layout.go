@@ -0,0 +1,201 @@
+package og
+
+import (
+	"image"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+const ellipsis = "…"
+
+// the smallest the title is shrunk to (as a fraction of its configured size) before we resort to breaking words
+const minTitleScale = 0.4
+
+// a run of wrapped lines set in a single face
+type textBlock struct {
+	lines      []string
+	face       font.Face
+	lineHeight fixed.Int26_6
+}
+
+// the lines of an image, as measured with the fonts they are drawn with
+type layout struct {
+	title    textBlock
+	subtitle textBlock
+	footer   textBlock
+	// baselines of the first title and subtitle line, and of the footer
+	titleY, subtitleY, footerY fixed.Int26_6
+}
+
+func newFace(f *truetype.Font, size float64, settings Settings) font.Face {
+	return truetype.NewFace(f, &truetype.Options{Size: size, DPI: settings.DPI, Hinting: font.HintingNone})
+}
+
+// the font size converted to pixels at the configured dpi
+func pixels(size float64, settings Settings) fixed.Int26_6 {
+	return fixed.Int26_6(size * settings.DPI / 72 * 64)
+}
+
+// Lays out title and subtitle inside the padded canvas, above the footer and logo (if any; logo holds the bounds of
+// the scaled logo). The title is shrunk until its words fit on their lines and leaves room for at least one line of
+// subtitle; subtitle lines that don't fit are dropped, with the last visible line truncated by an ellipsis.
+func layoutText(settings Settings, title, subtitle string, fTitle, fBase *truetype.Font, logo image.Rectangle) layout {
+	var l layout
+	maxWidth := fixed.I(settings.Width - 2*settings.Padding)
+	// guard against padding that swallows the whole canvas, which would leave no room for even a single rune
+	if maxWidth <= 0 {
+		maxWidth = fixed.I(1)
+	}
+	top := fixed.I(settings.Padding)
+	bottom := fixed.I(settings.Height - settings.Padding)
+
+	baseFace := newFace(fBase, settings.Size, settings)
+	baseLineHeight := fixed.Int26_6(float64(pixels(settings.Size, settings)) * settings.Spacing)
+	// the footer and logo share the bottom of the canvas: logo to the left, footer to the right
+	var reserved fixed.Int26_6
+	if !logo.Empty() {
+		reserved = fixed.I(logo.Dy()) + baseLineHeight/2
+	}
+	if settings.Footer != "" {
+		footerWidth := maxWidth
+		if !logo.Empty() {
+			footerWidth -= fixed.I(logo.Dx() + settings.Padding)
+		}
+		l.footer = textBlock{lines: []string{ellipsize(baseFace, settings.Footer, footerWidth)}, face: baseFace, lineHeight: baseLineHeight}
+		l.footerY = bottom
+		if baseLineHeight > reserved {
+			reserved = baseLineHeight
+		}
+	}
+	bottom -= reserved
+	if settings.Template == TEMPLATE_TITLE {
+		subtitle = ""
+	}
+	// the space between the last title line and the first subtitle line
+	gap := 2 * baseLineHeight
+	if subtitle == "" {
+		gap = 0
+	}
+
+	titleSize := settings.Size * settings.TitleMultiplier
+	minTitleSize := titleSize * minTitleScale
+	for {
+		face := newFace(fTitle, titleSize, settings)
+		l.title = textBlock{
+			lines:      wrapText(face, title, maxWidth),
+			face:       face,
+			lineHeight: fixed.Int26_6(float64(pixels(titleSize, settings)) * 0.75 * settings.Spacing),
+		}
+		l.titleY = top + face.Metrics().Ascent
+		titleBottom := l.titleY + fixed.Int26_6(len(l.title.lines)-1)*l.title.lineHeight
+		fits := titleBottom+gap <= bottom && wordsFit(face, title, maxWidth)
+		if fits || titleSize*0.9 < minTitleSize {
+			break
+		}
+		titleSize *= 0.9
+	}
+	l.title.lines = truncateLines(l.title, l.titleY, bottom, maxWidth)
+
+	l.subtitleY = l.titleY + fixed.Int26_6(len(l.title.lines)-1)*l.title.lineHeight + gap
+	l.subtitle = textBlock{lines: wrapText(baseFace, subtitle, maxWidth), face: baseFace, lineHeight: baseLineHeight}
+	l.subtitle.lines = truncateLines(l.subtitle, l.subtitleY, bottom, maxWidth)
+	return l
+}
+
+// drops the lines of block that would be drawn below bottom, ellipsizing the last line that remains
+func truncateLines(block textBlock, firstBaseline, bottom, maxWidth fixed.Int26_6) []string {
+	if len(block.lines) == 0 || firstBaseline > bottom {
+		return nil
+	}
+	if block.lineHeight <= 0 {
+		return block.lines
+	}
+	visible := 1 + int((bottom-firstBaseline)/block.lineHeight)
+	if visible >= len(block.lines) {
+		return block.lines
+	}
+	lines := block.lines[:visible]
+	lines[visible-1] = ellipsize(block.face, lines[visible-1]+" "+ellipsis, maxWidth)
+	return lines
+}
+
+// reports whether each word of s fits on a line of its own
+func wordsFit(face font.Face, s string, maxWidth fixed.Int26_6) bool {
+	for _, word := range strings.Fields(s) {
+		if font.MeasureString(face, word) > maxWidth {
+			return false
+		}
+	}
+	return true
+}
+
+// Wraps s into lines no wider than maxWidth. Words wider than maxWidth are broken between runes.
+func wrapText(face font.Face, s string, maxWidth fixed.Int26_6) []string {
+	var lines []string
+	var line string
+	for _, word := range strings.Fields(s) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if font.MeasureString(face, candidate) <= maxWidth {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+		}
+		for font.MeasureString(face, word) > maxWidth {
+			n := fittingPrefix(face, word, maxWidth)
+			lines = append(lines, word[:n])
+			word = word[n:]
+		}
+		line = word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// returns the byte length of the longest run of whole runes from the start of s that fits within maxWidth. at least
+// one rune is always returned, so that callers breaking s apart are guaranteed to make progress
+func fittingPrefix(face font.Face, s string, maxWidth fixed.Int26_6) int {
+	_, n := utf8.DecodeRuneInString(s)
+	for i := range s {
+		if i == 0 {
+			continue
+		}
+		if font.MeasureString(face, s[:i]) > maxWidth {
+			break
+		}
+		n = i
+	}
+	if font.MeasureString(face, s) <= maxWidth {
+		n = len(s)
+	}
+	return n
+}
+
+// Shortens s a rune at a time until it, followed by an ellipsis, fits within maxWidth. Strings that already fit are
+// returned as-is; a trailing ellipsis in s is treated as a request to always end with one.
+func ellipsize(face font.Face, s string, maxWidth fixed.Int26_6) string {
+	forced := strings.HasSuffix(s, ellipsis)
+	s = strings.TrimSpace(strings.TrimSuffix(s, ellipsis))
+	if !forced && font.MeasureString(face, s) <= maxWidth {
+		return s
+	}
+	for s != "" {
+		candidate := strings.TrimSpace(s) + ellipsis
+		if font.MeasureString(face, candidate) <= maxWidth {
+			return candidate
+		}
+		_, size := utf8.DecodeLastRuneInString(s)
+		s = s[:len(s)-size]
+	}
+	return ellipsis
+}
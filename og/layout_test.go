@@ -0,0 +1,235 @@
+package og
+
+import (
+	"image"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/golang/freetype/truetype"
+	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
+)
+
+func testFonts(t *testing.T) (*truetype.Font, *truetype.Font) {
+	t.Helper()
+	base, err := getFont("", DEFAULT_BASEFONT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	title, err := getFont("", DEFAULT_TITLEFONT)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return base, title
+}
+
+// fails unless every line is valid utf-8, and fits within maxWidth
+func checkLines(t *testing.T, face font.Face, lines []string, maxWidth fixed.Int26_6) {
+	t.Helper()
+	for i, line := range lines {
+		if !utf8.ValidString(line) {
+			t.Errorf("line %d is not valid utf-8: %q", i, line)
+		}
+		if width := font.MeasureString(face, line); width > maxWidth && utf8.RuneCountInString(line) > 1 {
+			t.Errorf("line %d (%q) is %v wide, wider than %v", i, line, width, maxWidth)
+		}
+	}
+}
+
+func TestWrapText(t *testing.T) {
+	base, _ := testFonts(t)
+	settings := GetDefaultSettings()
+	face := newFace(base, settings.Size, settings)
+	lineWidth := fixed.I(settings.Width - 2*settings.Padding)
+	tests := []struct {
+		name     string
+		text     string
+		maxWidth fixed.Int26_6
+		lines    int // the expected number of lines, or -1 for more than one
+	}{
+		{"empty", "", lineWidth, 0},
+		{"whitespace", " \t\n ", lineWidth, 0},
+		{"short", "a search engine", lineWidth, 1},
+		{"several lines", strings.Repeat("research into subjective trust-based moderation ", 4), lineWidth, -1},
+		{"word longer than a line", strings.Repeat("w", 200), lineWidth, -1},
+		{"multibyte word longer than a line", strings.Repeat("日本語のテキスト", 20), lineWidth, -1},
+		{"accents and emoji", strings.Repeat("ümlaut café 🙂 ", 12), lineWidth, -1},
+		{"narrower than a single rune", "äöü 日本", fixed.I(1), 5},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			lines := wrapText(face, test.text, test.maxWidth)
+			switch {
+			case test.lines == -1 && len(lines) < 2:
+				t.Fatalf("expected the text to wrap, got %q", lines)
+			case test.lines >= 0 && len(lines) != test.lines:
+				t.Fatalf("expected %d lines, got %d: %q", test.lines, len(lines), lines)
+			}
+			checkLines(t, face, lines, test.maxWidth)
+			// wrapping only ever breaks text apart: no runes are lost or added
+			joined := strings.ReplaceAll(strings.Join(lines, ""), " ", "")
+			want := strings.Join(strings.Fields(test.text), "")
+			if joined != want {
+				t.Errorf("expected the lines to hold %q, got %q", want, joined)
+			}
+		})
+	}
+}
+
+func TestFittingPrefix(t *testing.T) {
+	base, _ := testFonts(t)
+	settings := GetDefaultSettings()
+	face := newFace(base, settings.Size, settings)
+	tests := []struct {
+		name     string
+		text     string
+		maxWidth fixed.Int26_6
+		want     string
+	}{
+		{"fits entirely", "plain", fixed.I(1000), "plain"},
+		{"at least one rune", "plain", fixed.I(1), "p"},
+		{"at least one multibyte rune", "日本語", fixed.I(1), "日"},
+		{"breaks between runes", "ééééééééééééééééééééé", font.MeasureString(face, "éééé"), "éééé"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			n := fittingPrefix(face, test.text, test.maxWidth)
+			if got := test.text[:n]; got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+func TestEllipsize(t *testing.T) {
+	base, _ := testFonts(t)
+	settings := GetDefaultSettings()
+	face := newFace(base, settings.Size, settings)
+	maxWidth := font.MeasureString(face, "a subtitle of some length")
+	tests := []struct {
+		name     string
+		text     string
+		maxWidth fixed.Int26_6
+		want     string // the expected result, or "" to only check that it's shortened with an ellipsis
+	}{
+		{"fits", "short", maxWidth, "short"},
+		{"empty", "", maxWidth, ""},
+		{"too long", "a subtitle of some length, and then some", maxWidth, ""},
+		{"multibyte", strings.Repeat("日本語", 20), maxWidth, ""},
+		{"forced ellipsis", "short " + ellipsis, maxWidth, "short" + ellipsis},
+		{"no room for any text", "plain", fixed.I(1), ellipsis},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := ellipsize(face, test.text, test.maxWidth)
+			if test.want != "" || test.text == "" {
+				if got != test.want {
+					t.Errorf("expected %q, got %q", test.want, got)
+				}
+				return
+			}
+			if !strings.HasSuffix(got, ellipsis) || got == ellipsis {
+				t.Errorf("expected %q to be shortened and end with an ellipsis, got %q", test.text, got)
+			}
+			if !strings.HasPrefix(test.text, strings.TrimSuffix(got, ellipsis)) {
+				t.Errorf("expected %q to be a prefix of %q", strings.TrimSuffix(got, ellipsis), test.text)
+			}
+			checkLines(t, face, []string{got}, test.maxWidth)
+		})
+	}
+}
+
+func TestTruncateLines(t *testing.T) {
+	base, _ := testFonts(t)
+	settings := GetDefaultSettings()
+	face := newFace(base, settings.Size, settings)
+	maxWidth := fixed.I(settings.Width - 2*settings.Padding)
+	lineHeight := fixed.I(50)
+	block := func(lines ...string) textBlock {
+		return textBlock{lines: lines, face: face, lineHeight: lineHeight}
+	}
+	tests := []struct {
+		name          string
+		block         textBlock
+		first, bottom fixed.Int26_6
+		want          []string
+	}{
+		{"no lines", block(), fixed.I(100), fixed.I(500), nil},
+		{"all lines fit", block("one", "two"), fixed.I(100), fixed.I(500), []string{"one", "two"}},
+		{"first line below the bottom", block("one"), fixed.I(600), fixed.I(500), nil},
+		{"exactly at the line limit", block("one", "two", "three"), fixed.I(100), fixed.I(200), []string{"one", "two", "three"}},
+		{"ellipsis at the line limit", block("one", "two", "three", "four"), fixed.I(100), fixed.I(200), []string{"one", "two", "three" + ellipsis}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := truncateLines(test.block, test.first, test.bottom, maxWidth)
+			if strings.Join(got, "\n") != strings.Join(test.want, "\n") || len(got) != len(test.want) {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+// the ellipsis of a line as wide as the canvas takes the place of the line's last runes
+func TestTruncateFullLine(t *testing.T) {
+	base, _ := testFonts(t)
+	settings := GetDefaultSettings()
+	face := newFace(base, settings.Size, settings)
+	maxWidth := fixed.I(settings.Width - 2*settings.Padding)
+	full := wrapText(face, strings.Repeat("m", 100), maxWidth)[0]
+	block := textBlock{lines: []string{"one", full, "three"}, face: face, lineHeight: fixed.I(50)}
+	got := truncateLines(block, fixed.I(100), fixed.I(150), maxWidth)
+	if len(got) != 2 || !strings.HasSuffix(got[1], ellipsis) || utf8.RuneCountInString(got[1]) > utf8.RuneCountInString(full) {
+		t.Fatalf("expected two lines, the last shortened to end with an ellipsis, got %q", got)
+	}
+	checkLines(t, face, got, maxWidth)
+}
+
+func TestLayoutText(t *testing.T) {
+	base, title := testFonts(t)
+	tests := []struct {
+		name, title, subtitle string
+		template              string
+		logo                  image.Rectangle
+	}{
+		{"empty", "", "", TEMPLATE_TITLE_BRIEF, image.Rectangle{}},
+		{"empty title", "", "only a brief", TEMPLATE_TITLE_BRIEF, image.Rectangle{}},
+		{"single long word", strings.Repeat("supercalifragilistic", 8), "brief", TEMPLATE_TITLE_BRIEF, image.Rectangle{}},
+		{"long title", strings.Repeat("the pomodoro work week ", 12), "brief", TEMPLATE_TITLE_BRIEF, image.Rectangle{}},
+		{"long subtitle", "TrustNet", strings.Repeat("research into subjective, trust-based moderation systems ", 20), TEMPLATE_TITLE_BRIEF, image.Rectangle{}},
+		{"multibyte", strings.Repeat("日本語のタイトル", 6), strings.Repeat("ümlauts & emoji 🙂 ", 30), TEMPLATE_TITLE_BRIEF, image.Rectangle{}},
+		{"title only", "TrustNet", "dropped", TEMPLATE_TITLE, image.Rectangle{}},
+		{"with logo", "Lieu", strings.Repeat("a purpose-built community search engine ", 20), TEMPLATE_LOGO, image.Rect(0, 0, 96, 96)},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			settings := GetDefaultSettings()
+			settings.Template = test.template
+			settings.Footer = "example.com"
+			l := layoutText(settings, test.title, test.subtitle, title, base, test.logo)
+			maxWidth := fixed.I(settings.Width - 2*settings.Padding)
+			checkLines(t, l.title.face, l.title.lines, maxWidth)
+			checkLines(t, l.subtitle.face, l.subtitle.lines, maxWidth)
+			if test.title == "" && len(l.title.lines) != 0 {
+				t.Errorf("expected no title lines, got %q", l.title.lines)
+			}
+			if test.template == TEMPLATE_TITLE && len(l.subtitle.lines) != 0 {
+				t.Errorf("expected the title template to drop the subtitle, got %q", l.subtitle.lines)
+			}
+			// nothing is drawn below the bottom padding, or over the footer
+			bottom := fixed.I(settings.Height - settings.Padding)
+			if n := len(l.subtitle.lines); n > 0 {
+				last := l.subtitleY + fixed.Int26_6(n-1)*l.subtitle.lineHeight
+				if last >= l.footerY || last > bottom {
+					t.Errorf("the last subtitle line (at %v) overlaps the footer (at %v)", last, l.footerY)
+				}
+			}
+			if strings.Count(test.subtitle, " ") > 100 && test.template != TEMPLATE_TITLE {
+				if n := len(l.subtitle.lines); n == 0 || !strings.HasSuffix(l.subtitle.lines[n-1], ellipsis) {
+					t.Errorf("expected the long subtitle to be truncated with an ellipsis, got %q", l.subtitle.lines)
+				}
+			}
+		})
+	}
+}
@@ -7,34 +7,64 @@ package og
 
 import (
 	"bufio"
-	// "flag"
+	_ "embed"
+	"errors"
 	"fmt"
+	"html"
 	"image"
 	"image/color"
 	"image/draw"
+	_ "image/gif"
+	_ "image/jpeg"
 	"image/png"
-	"io/ioutil"
 	"log"
 	"os"
+	"strconv"
 	"strings"
 
 	"github.com/golang/freetype"
 	"github.com/golang/freetype/truetype"
+	xdraw "golang.org/x/image/draw"
 	"golang.org/x/image/font"
+	"golang.org/x/image/math/fixed"
 )
 
+//go:embed Inter-Regular.ttf
+var DEFAULT_BASEFONT []byte
+
+//go:embed RubikMicrobe-Regular.ttf
+var DEFAULT_TITLEFONT []byte
+
 type Settings struct {
-	dpi       float64
-	basefont  string
-	titlefont string
-	size      float64
-	spacing   float64
-
-	titleMultiplier float64
-	width           int
-	height          int
+	DPI       float64
+	BaseFont  string // path to a ttf font; the bundled Inter is used if empty
+	TitleFont string // path to a ttf font; the bundled Rubik Microbe is used if empty
+	Size      float64
+	Spacing   float64
+
+	TitleMultiplier float64
+	Width           int
+	Height          int
+	Padding         int
+
+	Foreground color.RGBA
+	Background color.RGBA
+	Footer     string // optional text drawn in the bottom right corner, e.g. the site's domain
+
+	Template string // one of TEMPLATE_TITLE, TEMPLATE_TITLE_BRIEF or TEMPLATE_LOGO
+	Logo     string // path to the site logo drawn in the bottom left corner by TEMPLATE_LOGO
+	LogoSize int    // the logo is scaled to fit a square of LogoSize pixels
 }
 
+// the layouts available for generated previews
+const (
+	TEMPLATE_TITLE       = "title"       // only the title
+	TEMPLATE_TITLE_BRIEF = "title-brief" // the title followed by the brief
+	TEMPLATE_LOGO        = "logo"        // the title & brief, with the site logo underneath
+)
+
+var Templates = []string{TEMPLATE_TITLE, TEMPLATE_TITLE_BRIEF, TEMPLATE_LOGO}
+
 type Article struct {
 	title    string
 	subtitle string
@@ -42,24 +72,37 @@ type Article struct {
 
 func GetDefaultSettings() Settings {
 	settings := Settings{
-		titleMultiplier: 3,
-		width:           1024,
-		height:          512,
-		dpi:             72,
-		basefont:        "./Inter-Regular.ttf",
-		titlefont:       "./RubikMicrobe-Regular.ttf",
-		size:            48,
-		spacing:         1,
-	}
-	// flag.Float64Var(&settings.dpi, "dpi", 72, "screen resolution in Dots Per Inch")
-	// flag.StringVar(&settings.basefont, "basefont", "./Inter-Regular.ttf", "filename of the ttf font")
-	// flag.StringVar(&settings.titlefont, "titlefont", "./Inter-Regular.ttf", "filename of the ttf font")
-	// flag.Float64Var(&settings.size, "size", settings.fontSize, "font size in points")
-	// flag.Float64Var(&settings.spacing, "spacing", 1, "line spacing (e.g. 2 means double spaced)")
-	// flag.Parse()
+		TitleMultiplier: 3,
+		Width:           1024,
+		Height:          512,
+		Padding:         48,
+		DPI:             72,
+		Size:            48,
+		Spacing:         1,
+		Foreground:      color.RGBA{R: 0xc1, G: 0xf1, B: 0xea, A: 0xff},
+		Background:      color.RGBA{R: 27, G: 55, B: 55, A: 0xff},
+		Template:        TEMPLATE_TITLE_BRIEF,
+		LogoSize:        96,
+	}
 	return settings
 }
 
+// Parses a css-style hex color, e.g. #1b3737 or #fff
+func ParseColor(s string) (color.RGBA, error) {
+	hex := strings.TrimPrefix(strings.TrimSpace(s), "#")
+	if len(hex) == 3 {
+		hex = fmt.Sprintf("%c%c%c%c%c%c", hex[0], hex[0], hex[1], hex[1], hex[2], hex[2])
+	}
+	if len(hex) != 6 {
+		return color.RGBA{}, fmt.Errorf("parse color: %q is not of the form #rrggbb", s)
+	}
+	v, err := strconv.ParseUint(hex, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("parse color: %q %w", s, err)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 0xff}, nil
+}
+
 // func main() {
 //   articles := []Article{
 //     Article{"TrustNet", "research into subjective, trust-based moderation systems"},
@@ -75,149 +118,140 @@ func GetDefaultSettings() Settings {
 //   }
 // }
 
-func GenerateImage(title, subtitle, outpath string, settings Settings) {
-	var text []string
-	text = append(text, breakText(strings.Title(strings.Replace(title, "the ", "", -1)), 10)...)
-	text = append(text, "")
-	text = append(text, breakText(subtitle, 31)...)
-
-	generate(settings, text, outpath)
+func GenerateImage(title, subtitle, outpath string, settings Settings) error {
+	title = strings.Title(strings.Replace(title, "the ", "", -1))
+	return generate(settings, title, subtitle, outpath)
 }
 
-func GenerateMetadata(title, subtitle, imagepath string, settings Settings) string {
-	return fmt.Sprintf(`
+// Returns the opengraph & twitter card meta tags for a page. pageURL and imageURL are expected to be absolute urls, as
+// most link preview consumers refuse relative ones. The image dimensions are omitted if width or height are unknown (0)
+func GenerateMetadata(title, subtitle, pageURL, imageURL string, width, height int) string {
+	meta := fmt.Sprintf(`
 	<meta property="og:title" content="%s"/>
-  <meta property="og:type" content="website" />
+	<meta property="og:type" content="website" />
 	<meta property="og:description" content="%s"/>
-	`, strings.Title(title), subtitle)
-  /* 
-  <meta property="og:image" content="%s"/>
-
-  <meta property="og:image:width" content="%d"/>
+	<meta property="og:url" content="%s"/>
+	<meta property="og:image" content="%s"/>
+	`, html.EscapeString(strings.Title(title)), html.EscapeString(subtitle), html.EscapeString(pageURL), html.EscapeString(imageURL))
+	if width > 0 && height > 0 {
+		meta += fmt.Sprintf(`<meta property="og:image:width" content="%d"/>
 	<meta property="og:image:height" content="%d"/>
-  */
+	`, width, height)
+	}
+	return meta + `<meta name="twitter:card" content="summary_large_image"/>
+	`
 }
 
-func breakText(source string, MAX_LENGTH int) []string {
-	var text []string
-	prevIndex := 0
-	lastIndex := len(source)
-	if len(source) < MAX_LENGTH {
-		return []string{source}
-	}
-	for {
-		lastIndex := strings.LastIndex(source[prevIndex:lastIndex], " ")
-		if lastIndex == 0 || lastIndex == prevIndex {
-			text = append(text, strings.TrimSpace(source[prevIndex:]))
-			break
+// Reads the font at filename, falling back to the bundled font if filename is unset or can't be read
+func getFont(filename string, fallback []byte) (*truetype.Font, error) {
+	fontBytes := fallback
+	if filename != "" {
+		b, err := os.ReadFile(filename)
+		if err != nil {
+			log.Println(err, "(using the bundled font instead)")
+		} else {
+			fontBytes = b
 		}
-		text = append(text, strings.TrimSpace(source[prevIndex:lastIndex]))
-		prevIndex = lastIndex
 	}
-	return text
+	return freetype.ParseFont(fontBytes)
 }
 
-func getFont(filename string) *truetype.Font {
-	// Read the font data.
-	fontBytes, err := ioutil.ReadFile(filename)
+// Reads the logo at filename, scaled down to fit within a size x size square
+func getLogo(filename string, size int) (image.Image, error) {
+	file, err := os.Open(filename)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
 	}
-	f, err := freetype.ParseFont(fontBytes)
+	defer file.Close()
+	src, _, err := image.Decode(file)
 	if err != nil {
-		log.Fatalln(err)
+		return nil, err
+	}
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	if w <= size && h <= size {
+		return src, nil
 	}
-	return f
+	if w > h {
+		w, h = size, h*size/w
+	} else {
+		w, h = w*size/h, size
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+	xdraw.CatmullRom.Scale(dst, dst.Bounds(), src, src.Bounds(), xdraw.Over, nil)
+	return dst, nil
+}
+
+// Draws logo with its top left corner at at. A logo's bounds need not start at 0,0 (e.g. a cropped sub-image)
+func drawLogo(dst draw.Image, logo image.Image, at image.Point) {
+	r := image.Rectangle{Min: at, Max: at.Add(logo.Bounds().Size())}
+	draw.Draw(dst, r, logo, logo.Bounds().Min, draw.Over)
 }
 
-func generate(settings Settings, text []string, outpath string) {
+func generate(settings Settings, title, subtitle, outpath string) error {
 	// Initialize the context.
-	fg, bg := image.NewUniform(color.RGBA{R: 0xc1, G: 0xf1, B: 0xea, A: 0xff}), image.NewUniform(color.RGBA{R: 27, G: 55, B: 55, A: 0xff})
-	rgba := image.NewRGBA(image.Rect(0, 0, settings.width, settings.height))
-	draw.Draw(rgba, rgba.Bounds(), bg, image.ZP, draw.Src)
-
-	f := getFont(settings.basefont)
-	fTitle := getFont(settings.titlefont)
-
-	c := freetype.NewContext()
-	c.SetDPI(settings.dpi)
-	c.SetFont(fTitle)
-	c.SetFontSize(settings.size)
-	c.SetClip(rgba.Bounds())
-	c.SetDst(rgba)
-	c.SetSrc(fg)
-	c.SetHinting(font.HintingNone)
-
-	var err error
-	// Draw the text.
-	pt := freetype.Pt(int(settings.size), int(settings.size/2)+int(c.PointToFixed(settings.size*settings.titleMultiplier)>>6))
-	titleMode := true
-	// figure out when we switch from titles to subtitles.
-	// this is important to make the spacing look right in the transition
-	var breakIndex int
-	for i, s := range text {
-		if s == "" {
-			breakIndex = i
-			break
-		}
+	fg, bg := image.NewUniform(settings.Foreground), image.NewUniform(settings.Background)
+	rgba := image.NewRGBA(image.Rect(0, 0, settings.Width, settings.Height))
+	draw.Draw(rgba, rgba.Bounds(), bg, image.Point{}, draw.Src)
+
+	f, err := getFont(settings.BaseFont, DEFAULT_BASEFONT)
+	if err != nil {
+		return fmt.Errorf("generate: could not parse base font %w", err)
+	}
+	fTitle, err := getFont(settings.TitleFont, DEFAULT_TITLEFONT)
+	if err != nil {
+		return fmt.Errorf("generate: could not parse title font %w", err)
 	}
 
-	for i, s := range text {
-		if titleMode {
-			c.SetFontSize(settings.size * settings.titleMultiplier)
-			c.SetFont(fTitle)
-		}
-		_, err = c.DrawString(s, pt)
+	var logo image.Image
+	if settings.Template == TEMPLATE_LOGO && settings.Logo != "" {
+		logo, err = getLogo(settings.Logo, settings.LogoSize)
 		if err != nil {
-			log.Println(err)
-			return
-		}
-		if s == "" {
-			titleMode = false
-			c.SetFont(f)
-			c.SetFontSize(settings.size)
-		}
-		if breakIndex == i+1 || !titleMode {
-			pt.Y += c.PointToFixed(settings.size * settings.spacing)
-		} else if titleMode {
-			pt.Y += c.PointToFixed(settings.size * settings.titleMultiplier * 0.75 * settings.spacing)
+			return fmt.Errorf("generate: could not read logo %w", err)
 		}
+		drawLogo(rgba, logo, image.Pt(settings.Padding, settings.Height-settings.Padding-logo.Bounds().Dy()))
+	}
+	var logoBounds image.Rectangle
+	if logo != nil {
+		logoBounds = logo.Bounds()
 	}
 
-	// output a footer onto the image
-	// pt.Y = c.PointToFixed(float64(settings.height) - 0.75 * *settings.size)
-	// charWidth := settings.width / 46 // experimentally begotten: 46 characters (size 48pt) will fit into 1024px at 72dpi
-	// footer := "cblgh.org"
-	// pt.X = c.PointToFixed(float64(settings.width - len(footer) * charWidth) - 1.75 * *settings.size)
-	// for _, s := range []string{footer} {
-	//   _, err = c.DrawString(s, pt)
-	//   if err != nil {
-	//     log.Println(err)
-	//     return
-	//   }
-	// 	pt.Y -= c.PointToFixed(settings.size * *settings.spacing)
-	// }
+	l := layoutText(settings, strings.TrimSpace(title), strings.TrimSpace(subtitle), fTitle, f, logoBounds)
+	d := &font.Drawer{Dst: rgba, Src: fg}
+	drawBlock := func(block textBlock, baseline fixed.Int26_6) {
+		d.Face = block.face
+		for _, line := range block.lines {
+			d.Dot = fixed.Point26_6{X: fixed.I(settings.Padding), Y: baseline}
+			d.DrawString(line)
+			baseline += block.lineHeight
+		}
+	}
+	drawBlock(l.title, l.titleY)
+	drawBlock(l.subtitle, l.subtitleY)
+	// output a footer onto the image, right-aligned against the padding
+	for _, line := range l.footer.lines {
+		d.Face = l.footer.face
+		d.Dot = fixed.Point26_6{X: fixed.I(settings.Width-settings.Padding) - d.MeasureString(line), Y: l.footerY}
+		d.DrawString(line)
+	}
 
 	err = os.Remove(outpath)
-	if err != nil {
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
 		log.Println(err)
 	}
 	// Save that RGBA image to disk.
 	outFile, err := os.Create(outpath)
 	if err != nil {
-		log.Println(err)
-		os.Exit(1)
+		return fmt.Errorf("generate: could not create %s %w", outpath, err)
 	}
 	defer outFile.Close()
 	b := bufio.NewWriter(outFile)
 	err = png.Encode(b, rgba)
 	if err != nil {
-		log.Println(err)
-		os.Exit(1)
+		return fmt.Errorf("generate: could not encode %s %w", outpath, err)
 	}
 	err = b.Flush()
 	if err != nil {
-		log.Println(err)
+		return fmt.Errorf("generate: could not write %s %w", outpath, err)
 	}
-	fmt.Printf("Wrote %s OK.\n", outpath)
+	return nil
 }
@@ -0,0 +1,46 @@
+package og
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestDrawLogo(t *testing.T) {
+	red := color.RGBA{255, 0, 0, 255}
+	white := color.RGBA{255, 255, 255, 255}
+	filled := func(r image.Rectangle) *image.RGBA {
+		img := image.NewRGBA(r)
+		draw.Draw(img, r, image.NewUniform(red), image.Point{}, draw.Src)
+		return img
+	}
+	// a sheet with only its bottom right corner filled in
+	sheet := image.NewRGBA(image.Rect(0, 0, 40, 40))
+	draw.Draw(sheet, image.Rect(20, 20, 30, 30), image.NewUniform(red), image.Point{}, draw.Src)
+	tests := []struct {
+		name string
+		logo image.Image
+	}{
+		{"bounds at the origin", filled(image.Rect(0, 0, 10, 10))},
+		{"bounds away from the origin", filled(image.Rect(5, 15, 15, 25))},
+		{"cropped from a larger image", sheet.SubImage(image.Rect(20, 20, 30, 30))},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dst := image.NewRGBA(image.Rect(0, 0, 100, 100))
+			draw.Draw(dst, dst.Bounds(), image.NewUniform(white), image.Point{}, draw.Src)
+			drawLogo(dst, test.logo, image.Pt(50, 60))
+			for _, p := range []image.Point{{50, 60}, {59, 69}} {
+				if got := dst.RGBAAt(p.X, p.Y); got != red {
+					t.Errorf("expected the logo at %v, got %v", p, got)
+				}
+			}
+			for _, p := range []image.Point{{49, 60}, {60, 60}, {50, 70}, {70, 80}} {
+				if got := dst.RGBAAt(p.X, p.Y); got != white {
+					t.Errorf("expected nothing drawn at %v, got %v", p, got)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package og
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/cblgh/plain/util"
+	"os"
+)
+
+// structure of og-store.json:
+// {
+//  <imageName> : <fingerprint of the title, subtitle & settings the image was generated from>
+//  ..
+// }
+const OG_STORE = "og-store.json"
+
+func OpenStore() map[string]string {
+	b, err := os.ReadFile(OG_STORE)
+	if errors.Is(err, os.ErrNotExist) {
+		return make(map[string]string)
+	}
+	util.Check(err)
+	var v map[string]string
+	err = json.Unmarshal(b, &v)
+	util.Check(err)
+	if v == nil {
+		v = make(map[string]string)
+	}
+	return v
+}
+
+func SaveStore(ogmap map[string]string) error {
+	b, err := json.MarshalIndent(ogmap, "", "  ")
+	if err != nil {
+		return fmt.Errorf("save store: could not marshal map %w", err)
+	}
+	err = os.WriteFile(OG_STORE, b, 0666)
+	if err != nil {
+		return fmt.Errorf("save store: could not save %s %w", OG_STORE, err)
+	}
+	return nil
+}
+
+// Fingerprint identifies the text & settings an image was rendered from, letting us skip regenerating unchanged images
+func Fingerprint(title, subtitle string, settings Settings) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%s\n%s\n%v", title, subtitle, settings))))
+}
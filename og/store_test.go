@@ -0,0 +1,41 @@
+package og
+
+import (
+	"os"
+	"testing"
+)
+
+// images recorded in the store are found by their fingerprint after a save & reopen, even if the store held null
+func TestStoreRoundTrip(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	settings := GetDefaultSettings()
+	for _, previous := range []string{"", "null", `{"lieu.png": "0123"}`} {
+		if err := os.Chdir(t.TempDir()); err != nil {
+			t.Fatal(err)
+		}
+		if previous != "" {
+			if err := os.WriteFile(OG_STORE, []byte(previous), 0666); err != nil {
+				t.Fatal(err)
+			}
+		}
+		store := OpenStore()
+		store["trustnet.png"] = Fingerprint("TrustNet", "subjective moderation", settings)
+		if err := SaveStore(store); err != nil {
+			t.Fatal(err)
+		}
+		reopened := OpenStore()
+		if reopened["trustnet.png"] != Fingerprint("TrustNet", "subjective moderation", settings) {
+			t.Errorf("store %q: expected trustnet.png to keep its fingerprint, got %v", previous, reopened)
+		}
+		if reopened["trustnet.png"] == Fingerprint("TrustNet", "another subtitle", settings) {
+			t.Errorf("store %q: expected a changed subtitle to change the fingerprint", previous)
+		}
+		if previous == `{"lieu.png": "0123"}` && reopened["lieu.png"] != "0123" {
+			t.Errorf("store %q: expected lieu.png to be kept, got %v", previous, reopened)
+		}
+	}
+}
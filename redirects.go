@@ -0,0 +1,122 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// besides the redirect pages written for mv & as, plain can write the same redirects as rules for web servers, which
+// redirect with a proper http status: a redirect page is invisible to non-html clients, and search engines may not
+// carry a page's ranking over to where it moved. the formats to write are listed by redirect-maps in the config file.
+// rules served from the webroot (.htaccess, _redirects) are written into it, while server configuration is written
+// into the working directory, to be included by the server's own configuration. each file starts with
+// redirectMapHeader, and files without it (e.g. a site's own .htaccess) are never overwritten
+
+type redirectRule struct {
+	source      string // the route being redirected, e.g. /articles/trustnet.html
+	destination string // the link the route redirects to
+}
+
+var redirectRules []redirectRule // every redirect written by mv and as during this build
+
+type redirectMap struct {
+	filename string                                              // the file the rules are written to
+	webroot  bool                                                // whether the file is written into the webroot
+	rule     func(source, destination string, status int) string // formats a single rule
+}
+
+var redirectMaps = map[string]redirectMap{
+	"nginx": {"redirects.nginx", false, func(source, destination string, status int) string {
+		return fmt.Sprintf("location = %s { return %d %s; }", nginxQuote(source), status, nginxQuote(destination))
+	}},
+	"apache": {".htaccess", true, func(source, destination string, status int) string {
+		// Redirect matches any route starting with source, so the route is matched exactly with RedirectMatch
+		return fmt.Sprintf("RedirectMatch %d %s %s", status, quote("^"+regexp.QuoteMeta(source)+"$"), quote(destination))
+	}},
+	"caddy": {"redirects.caddy", false, func(source, destination string, status int) string {
+		return fmt.Sprintf("redir %s %s %d", quote(source), quote(destination), status)
+	}},
+	"netlify": {"_redirects", true, func(source, destination string, status int) string {
+		return fmt.Sprintf("%s %s %d", strings.ReplaceAll(source, " ", "%20"), strings.ReplaceAll(destination, " ", "%20"), status)
+	}},
+}
+
+// the first line of every redirect map, marking it as written by plain (all four formats take # comments)
+const redirectMapHeader = "# written by plain from the mv & as commands of the site; changes are overwritten"
+
+// quotes s for apache & caddy, which only treat backslashes as escapes before a quote
+func quote(s string) string {
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+func nginxQuote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
+
+// the urls a redirected route is requested at: /about is also requested as /about/, while /about.html is not
+func redirectSources(route string) []string {
+	route = "/" + strings.Trim(route, "/")
+	if route == "/" || filepath.Ext(route) != "" {
+		return []string{route}
+	}
+	return []string{route, route + "/"}
+}
+
+// writes the redirect rules in each format listed by redirect-maps (nginx, apache, caddy, netlify)
+func writeRedirectMaps() error {
+	formats := strings.Fields(configString("redirect-maps", ""))
+	if len(formats) == 0 {
+		return nil
+	}
+	status := configInt("redirect-status", 301)
+	switch status {
+	case 301, 302, 307, 308:
+	default:
+		log.Fatalln(fmt.Sprintf("config: redirect-status expects 301, 302, 307 or 308, got %d", status))
+	}
+	for _, format := range formats {
+		m, exists := redirectMaps[format]
+		if !exists {
+			fmt.Printf("plain: unknown redirect map %q (expected nginx, apache, caddy or netlify), ignoring it\n", format)
+			continue
+		}
+		var rules []string
+		seen := make(map[string]bool)
+		for _, r := range redirectRules {
+			sources := redirectSources(r.source)
+			// netlify matches routes regardless of their trailing slash
+			if format == "netlify" {
+				sources = sources[:1]
+			}
+			for _, source := range sources {
+				if seen[source] {
+					continue
+				}
+				seen[source] = true
+				rules = append(rules, m.rule(source, r.destination, status))
+			}
+		}
+		path := m.filename
+		if m.webroot {
+			path = filepath.Join(OUTPATH, m.filename)
+		}
+		if b, err := os.ReadFile(path); err == nil && !strings.HasPrefix(string(b), redirectMapHeader+"\n") {
+			fmt.Printf("plain: %s was not written by plain, leaving it as is instead of writing the %s redirect rules to it\n", path, format)
+			continue
+		} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		echo("writing redirect rules to", path)
+		rules = append([]string{redirectMapHeader}, rules...)
+		err := os.WriteFile(path, []byte(strings.Join(rules, "\n")+"\n"), 0666)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
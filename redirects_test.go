@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// redirect maps written by plain are rewritten on every build, while a site's own files are left as they are
+func TestWriteRedirectMaps(t *testing.T) {
+	inSite(t, map[string]string{"web/.htaccess": "ErrorDocument 404 /404.html\n"})
+	previousOut, previousRules := OUTPATH, redirectRules
+	OUTPATH, redirectRules = "web", []redirectRule{{source: "/old", destination: "/new"}}
+	config = map[string]string{"redirect-maps": "apache netlify"}
+	defer func() { OUTPATH, redirectRules, config = previousOut, previousRules, nil }()
+
+	for build := 0; build < 2; build++ {
+		if err := writeRedirectMaps(); err != nil {
+			t.Fatal(err)
+		}
+		htaccess, err := os.ReadFile(filepath.Join("web", ".htaccess"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(htaccess) != "ErrorDocument 404 /404.html\n" {
+			t.Errorf("expected the site's own .htaccess to be left as is, got %q", htaccess)
+		}
+		redirects, err := os.ReadFile(filepath.Join("web", "_redirects"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := redirectMapHeader + "\n/old /new 301\n"
+		if string(redirects) != want {
+			t.Errorf("expected _redirects to hold %q, got %q", want, redirects)
+		}
+	}
+}
+
+func TestWriteRedirect(t *testing.T) {
+	legacyRedirect := "<head>\n\t<noscript>\n\t\t" + LEGACY_REDIRECT_REFRESH + "\n\t</noscript>\n</head>\n<body>\n\t<main>\n\t\t<p>Redirecting</p>\n\t</main>\n</body>"
+	tests := []struct {
+		name     string
+		existing string // the file at the redirect's route, if any
+		written  bool
+	}{
+		{"nothing there", "", true},
+		{"redirect from a previous build", REDIRECT_MARKER, true},
+		{"redirect from an earlier version", legacyRedirect, true},
+		{"page", "<main><p>a page</p></main>", false},
+		{"page with a refresh of its own", `<meta http-equiv="refresh" content="30"><main><p>Redirecting</p></main>`, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inSite(t, nil)
+			previousRules := redirectRules
+			redirectRules = nil
+			defer func() { redirectRules = previousRules }()
+			if test.existing != "" {
+				if err := os.WriteFile("old.html", []byte(test.existing), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := writeRedirect("old.html", "/old.html", "/new"); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile("old.html")
+			if err != nil {
+				t.Fatal(err)
+			}
+			written := isRedirectPage(string(b)) && strings.Contains(string(b), `url=/new"`)
+			if written != test.written {
+				t.Errorf("expected the redirect to be written: %v, got %q", test.written, b)
+			}
+			if !test.written && string(b) != test.existing {
+				t.Errorf("expected the page to be left as is, got %q", b)
+			}
+			if got := len(redirectRules) == 1; got != test.written {
+				t.Errorf("expected the redirect to be listed for the redirect maps: %v, got %v", test.written, redirectRules)
+			}
+		})
+	}
+}
+
+func TestDumpRedirectFile(t *testing.T) {
+	tests := []struct {
+		name, from, to, url string
+		file                string   // the redirect page, relative to the webroot
+		want                []string // substrings of the redirect page
+	}{
+		{"html route", "/second.html", "/2nd", "", "second.html", []string{`<meta http-equiv="refresh" content="0; url=/2nd">`, `<link rel="canonical" href="/2nd">`, `<a href="/2nd">/2nd</a>`}},
+		{"directory route", "/about", "/articles/about", "", filepath.Join("about", "index.html"), []string{`url=/articles/about"`}},
+		{"nested route", "/articles/old/trustnet.html", "/trustnet", "", filepath.Join("articles", "old", "trustnet.html"), []string{`url=/trustnet"`}},
+		{"absolute canonical link", "/old", "/new", "https://example.com", filepath.Join("old", "index.html"), []string{`<link rel="canonical" href="https://example.com/new">`, `url=/new"`}},
+		{"remote destination", "/code", "https://github.com/cblgh/plain", "https://example.com", filepath.Join("code", "index.html"), []string{`<link rel="canonical" href="https://github.com/cblgh/plain">`}},
+		{"escaped destination", "/q", `/search?a=1&b="2"`, "", filepath.Join("q", "index.html"), []string{`url=/search?a=1&amp;b=&#34;2&#34;"`}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			inSite(t, map[string]string{"web/index.html": ""})
+			previousOut, previousURL, previousRules := OUTPATH, canonicalUrl, redirectRules
+			OUTPATH, canonicalUrl, redirectRules = "web", test.url, nil
+			defer func() { OUTPATH, canonicalUrl, redirectRules = previousOut, previousURL, previousRules }()
+			if err := DumpRedirectFile(test.from, test.to); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(filepath.Join("web", test.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(string(b), want) {
+					t.Errorf("expected the redirect page to contain %q, got %q", want, b)
+				}
+			}
+			if len(redirectRules) != 1 || redirectRules[0] != (redirectRule{source: test.from, destination: test.to}) {
+				t.Errorf("expected the redirect to be recorded for the redirect maps, got %v", redirectRules)
+			}
+		})
+	}
+}
+
+func TestRedirectMapFormats(t *testing.T) {
+	rules := []redirectRule{{source: "/about", destination: "/articles/about"}, {source: "/second.html", destination: "/2nd"}, {source: "/a b", destination: `/q"x`}}
+	tests := []struct {
+		format, file string
+		status       string
+		want         []string // the rules, after the header
+	}{
+		{"nginx", "redirects.nginx", "", []string{
+			`location = "/about" { return 301 "/articles/about"; }`,
+			`location = "/about/" { return 301 "/articles/about"; }`,
+			`location = "/second.html" { return 301 "/2nd"; }`,
+			`location = "/a b" { return 301 "/q\"x"; }`,
+			`location = "/a b/" { return 301 "/q\"x"; }`,
+		}},
+		{"apache", filepath.Join("web", ".htaccess"), "308", []string{
+			`RedirectMatch 308 "^/about$" "/articles/about"`,
+			`RedirectMatch 308 "^/about/$" "/articles/about"`,
+			`RedirectMatch 308 "^/second\.html$" "/2nd"`,
+			`RedirectMatch 308 "^/a b$" "/q\"x"`,
+			`RedirectMatch 308 "^/a b/$" "/q\"x"`,
+		}},
+		{"caddy", "redirects.caddy", "302", []string{
+			`redir "/about" "/articles/about" 302`,
+			`redir "/about/" "/articles/about" 302`,
+			`redir "/second.html" "/2nd" 302`,
+			`redir "/a b" "/q\"x" 302`,
+			`redir "/a b/" "/q\"x" 302`,
+		}},
+		{"netlify", filepath.Join("web", "_redirects"), "", []string{
+			`/about /articles/about 301`,
+			`/second.html /2nd 301`,
+			`/a%20b /q"x 301`,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			inSite(t, map[string]string{"web/index.html": ""})
+			previousOut, previousRules := OUTPATH, redirectRules
+			OUTPATH, redirectRules = "web", rules
+			config = map[string]string{"redirect-maps": test.format}
+			if test.status != "" {
+				config["redirect-status"] = test.status
+			}
+			defer func() { OUTPATH, redirectRules, config = previousOut, previousRules, nil }()
+			if err := writeRedirectMaps(); err != nil {
+				t.Fatal(err)
+			}
+			b, err := os.ReadFile(test.file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := strings.Join(append([]string{redirectMapHeader}, test.want...), "\n") + "\n"
+			if string(b) != want {
+				t.Errorf("expected %s to hold\n%s\ngot\n%s", test.file, want, b)
+			}
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+)
+
+// pages are written as <route>/index.html and linked as /route by default ("pretty" urls), which needs a web server
+// that serves a directory's index.html. for hosts that serve flat files better, setting urls to html writes pages as
+// <route>.html instead, linked as /route.html. every link plain generates to a page (listicle entries, navigation,
+// back links & breadcrumbs, feeds, redirects, wikilinks, canonical urls) goes through routeLink, so the two modes
+// never mix
+
+// reports whether pages are written & linked as <route>.html
+func htmlURLs() bool {
+	switch mode := configString("urls", "pretty"); mode {
+	case "pretty":
+		return false
+	case "html":
+		return true
+	default:
+		log.Fatalln(fmt.Sprintf("config: urls expects pretty or html, got %q", mode))
+	}
+	return false
+}
+
+// the file the page of a route is written to, relative to the webroot: /articles/trustnet ->
+// /articles/trustnet/index.html, or /articles/trustnet.html
+func routeFile(route string) string {
+	route = filepath.Join("/", route)
+	if route == "/" || !htmlURLs() {
+		return filepath.Join(route, "index.html")
+	}
+	return route + ".html"
+}
+
+// the link to the page of a route: /articles/trustnet, or /articles/trustnet.html. with trailing-slash set, pretty
+// urls are linked as /articles/trustnet/, the url servers answer with the page's index.html directly
+func routeLink(route string) string {
+	if route == "" {
+		return ""
+	}
+	route = filepath.Join("/", route)
+	if route == "/" {
+		return route
+	}
+	if htmlURLs() {
+		return route + ".html"
+	}
+	if configBool("trailing-slash", false) {
+		return route + "/"
+	}
+	return route
+}
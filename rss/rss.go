@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"github.com/cblgh/plain/util"
+	"html"
 	"os"
 	"path/filepath"
 	"strings"
@@ -38,6 +39,9 @@ func OpenStore() map[string]FeedItem {
 	var v map[string]FeedItem
 	err = json.Unmarshal(b, &v)
 	util.Check(err)
+	if v == nil {
+		v = make(map[string]FeedItem)
+	}
 	return v
 }
 
@@ -82,8 +86,13 @@ const RSS_ITEM = `<item>
   <pubDate><![CDATA[%s]]></pubDate>
 </item>`
 
+// a CDATA section ends at the first ]]>, so split any occurrence across two sections
+func escapeCDATA(s string) string {
+	return strings.ReplaceAll(s, "]]>", "]]]]><![CDATA[>")
+}
+
 func OutputRSSItem(pubdate, title, brief, link string) string {
-	return fmt.Sprintf(RSS_ITEM, title, link, brief, pubdate)
+	return fmt.Sprintf(RSS_ITEM, escapeCDATA(title), escapeCDATA(link), escapeCDATA(brief), escapeCDATA(pubdate))
 }
 
 const RSS_TEMPLATE = `<rss version="2.0">
@@ -96,5 +105,5 @@ const RSS_TEMPLATE = `<rss version="2.0">
 </rss>`
 
 func OutputRSS(title, link, desc string, items []string) string {
-	return fmt.Sprintf(RSS_TEMPLATE, title, link, desc, strings.Join(items, "\n"))
+	return fmt.Sprintf(RSS_TEMPLATE, html.EscapeString(title), html.EscapeString(link), html.EscapeString(desc), strings.Join(items, "\n"))
 }
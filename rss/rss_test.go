@@ -0,0 +1,98 @@
+package rss
+
+import (
+	"encoding/xml"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestEscapeCDATA(t *testing.T) {
+	tests := []struct {
+		name, in, want string
+	}{
+		{"plain", "a post", "a post"},
+		{"end of section", "a]]>b", "a]]]]><![CDATA[>b"},
+		{"repeated", "]]>]]>", "]]]]><![CDATA[>]]]]><![CDATA[>"},
+		{"brackets alone", "a]] > b ]", "a]] > b ]"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := escapeCDATA(test.in); got != test.want {
+				t.Errorf("expected %q, got %q", test.want, got)
+			}
+		})
+	}
+}
+
+// items read back by an xml parser hold exactly the text they were written with, whatever it contains
+func TestOutputRSSItem(t *testing.T) {
+	type item struct {
+		Title       string `xml:"title"`
+		Link        string `xml:"link"`
+		Description string `xml:"description"`
+		PubDate     string `xml:"pubDate"`
+	}
+	tests := []struct {
+		name string
+		in   item
+	}{
+		{"plain", item{"a post", "https://example.com/a-post", "a brief", "Mon, 02 Jan 2006 15:04:05 -0700"}},
+		{"markup", item{`<b>"bold"</b> & co`, "https://example.com/?a=1&b=2", "<script>alert(1)</script>", "today"}},
+		{"end of section", item{"a]]><script>alert(1)</script>", "https://example.com/]]>", "]]>]]>", "]]>"}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			output := OutputRSSItem(test.in.PubDate, test.in.Title, test.in.Description, test.in.Link)
+			var got item
+			if err := xml.Unmarshal([]byte(output), &got); err != nil {
+				t.Fatalf("could not parse %q: %v", output, err)
+			}
+			if got != test.in {
+				t.Errorf("expected %+v, got %+v from %q", test.in, got, output)
+			}
+			if strings.Count(output, "<item>") != 1 || strings.Count(output, "</item>") != 1 {
+				t.Errorf("expected the item's text to stay within its CDATA sections, got %q", output)
+			}
+		})
+	}
+}
+
+// items keep the date they were first published with across builds, including when the store held null
+func TestStoreRoundTrip(t *testing.T) {
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+	tests := []struct {
+		name, store string
+		items       int
+	}{
+		{"no store", "", 1},
+		{"null", "null", 1},
+		{"previous items", `{"/lieu": {"RSSItem": "<item></item>", "Pubdate": 1600000000}}`, 2},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := os.Chdir(t.TempDir()); err != nil {
+				t.Fatal(err)
+			}
+			if test.store != "" {
+				if err := os.WriteFile(RSS_STORE, []byte(test.store), 0666); err != nil {
+					t.Fatal(err)
+				}
+			}
+			store := OpenStore()
+			item := FeedItem{RSSItem: OutputRSSItem("Mon, 02 Jan 2006 15:04:05 -0700", "TrustNet", "a brief", "https://example.com/trustnet"), Pubdate: 1136239445}
+			store["/trustnet"] = item
+			if err := SaveStore(store); err != nil {
+				t.Fatal(err)
+			}
+			reopened := OpenStore()
+			if reopened["/trustnet"] != item || len(reopened) != test.items {
+				t.Errorf("expected %d items, including %+v, got %+v", test.items, item, reopened)
+			}
+		})
+	}
+}
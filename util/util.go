@@ -3,7 +3,6 @@ package util
 import (
 	"log"
 	"net/url"
-	"fmt"
 	"regexp"
 	"strings"
 )
@@ -20,7 +19,6 @@ func ConstructURL(canonicalURL, path string) string {
 	u, err := url.Parse(canonicalURL)
 	Check(err)
 	u.Path = path
-	fmt.Println(u.String())
 	return u.String()
 }
 